@@ -0,0 +1,91 @@
+// chatclient talks to a cli_chat server started with -serve, acting as a
+// remote customer: each line read from stdin is sent as a message and Agent
+// replies are printed as they arrive.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+func main() {
+	server := flag.String("server", "http://localhost:8080", "base url of the chat server")
+	flag.Parse()
+
+	if err := run(strings.TrimRight(*server, "/")); err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(1)
+	}
+}
+
+func run(server string) error {
+	resp, err := http.Post(server+"/api/sessions", "application/json", nil)
+	if err != nil {
+		return err
+	}
+	var created struct {
+		SessionID string `json:"session_id"`
+		Token     string `json:"token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	fmt.Println("Session:", created.SessionID)
+
+	base := server + "/api/sessions/" + created.SessionID
+	query := "?token=" + url.QueryEscape(created.Token)
+	events, err := http.Get(base + "/events" + query)
+	if err != nil {
+		return err
+	}
+	defer events.Body.Close()
+	go listen(events)
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		body, _ := json.Marshal(map[string]string{"text": text})
+		resp, err := http.Post(base+"/messages"+query, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			fmt.Println("Error:", resp.Status)
+		}
+	}
+	return scanner.Err()
+}
+
+// listen prints the Agent messages streamed from the server.
+func listen(resp *http.Response) {
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		var msg struct {
+			Sender string `json:"sender"`
+			Text   string `json:"text"`
+		}
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			continue
+		}
+		fmt.Printf("%s: %s\n", msg.Sender, msg.Text)
+	}
+}
@@ -1,32 +1,439 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	clichat "github.com/jpoz/clichat/pkg"
 )
 
 func main() {
-	f, err := tea.LogToFile("debug.log", "debug")
+	if len(os.Args) > 1 && (os.Args[1] == "log" || os.Args[1] == "usage") {
+		run := runLog
+		if os.Args[1] == "usage" {
+			run = runUsage
+		}
+		if err := run(os.Args[2:]); err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	path := configPath(os.Args[1:])
+	cfg, err := clichat.LoadConfig(path)
 	if err != nil {
 		fmt.Println("fatal:", err)
 		os.Exit(1)
 	}
-	defer f.Close()
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(1)
+	}
+
+	temperature := float64(cfg.Provider.Temperature)
+	protocol := string(cfg.Agent.ToolProtocol)
+	format := string(cfg.Agent.ResponseFormat)
+	var resume string
+	var listSessions bool
+	var batch, transcript string
+	var evalCases, evalReport string
+	var policySpec string
+
+	// Flags default to the config file and environment so they override both.
+	flag.String("config", path, "YAML config file (default clichat.yaml if present, or $CLICHAT_CONFIG)")
+	flag.StringVar(&cfg.Provider.Name, "provider", cfg.Provider.Name, "model provider: openai, http or scripted")
+	flag.StringVar(&cfg.Provider.Model, "model", cfg.Provider.Model, "model name")
+	flag.Float64Var(&temperature, "temperature", temperature, "sampling temperature")
+	flag.StringVar(&cfg.Provider.BaseURL, "base-url", cfg.Provider.BaseURL, "base url of an OpenAI compatible server (http provider)")
+	flag.StringVar(&cfg.Provider.FallbackModel, "fallback-model", cfg.Provider.FallbackModel, "model to try when -model keeps failing")
+	flag.StringVar(&cfg.Provider.ScriptPath, "script", cfg.Provider.ScriptPath, "JSON file of canned responses (scripted provider)")
+	flag.StringVar(&cfg.Agent.Prompt, "prompt", cfg.Agent.Prompt, "name of the default prompt template (default the builtin prompt for -response-format)")
+	flag.StringVar(&format, "response-format", format, "how the model lays out its replies: react or json")
+	flag.Float64Var(&cfg.Agent.MinConfidence, "min-confidence", cfg.Agent.MinConfidence, "escalate to a human when the model's confidence is below this (json format)")
+	flag.StringVar(&cfg.Agent.PromptDir, "prompt-dir", cfg.Agent.PromptDir, "directory of *.tmpl prompt templates, reloaded when they change")
+	flag.IntVar(&cfg.Agent.MaxSteps, "max-steps", cfg.Agent.MaxSteps, "maximum reason/act/observe steps per customer message")
+	flag.DurationVar(&cfg.Agent.Timeout, "agent-timeout", cfg.Agent.Timeout, "maximum time for one agent run")
+	flag.DurationVar(&cfg.Agent.CallTimeout, "call-timeout", cfg.Agent.CallTimeout, "maximum time for one model call")
+	flag.DurationVar(&cfg.Agent.ApprovalTimeout, "approval-timeout", cfg.Agent.ApprovalTimeout, "how long an action waits for the operator before it counts as rejected")
+	flag.IntVar(&cfg.Agent.Retries, "retries", cfg.Agent.Retries, "retries of a model call after rate limits, server errors or timeouts")
+	flag.StringVar(&protocol, "tool-protocol", protocol, "how tools are offered to the model: react or functions")
+	flag.StringVar(&cfg.Logs.SessionDir, "session-dir", cfg.Logs.SessionDir, "directory conversations are saved to")
+	flag.StringVar(&resume, "resume", "", "resume the session with this id")
+	flag.BoolVar(&listSessions, "sessions", false, "list saved sessions and exit")
+	flag.StringVar(&batch, "batch", "", "run headless, replaying the customer turns in this file")
+	flag.StringVar(&transcript, "transcript", "", "write the batch transcript to this file instead of stdout")
+	flag.StringVar(&evalCases, "eval", "", "run the evaluation cases in this JSON file and exit")
+	flag.StringVar(&evalReport, "eval-report", "", "write the evaluation report as JSON to this file")
+	flag.StringVar(&cfg.Orders, "orders", cfg.Orders, "order data: a .json or .csv file, or the base url of an order service (default demo data)")
+	flag.StringVar(&policySpec, "policy", "", "comma separated Tool=auto|approve|forbidden overrides, e.g. ReturnOrderFlow=auto")
+	flag.BoolVar(&cfg.Agent.Copilot, "copilot", cfg.Agent.Copilot, "place AI replies in the agent box as drafts instead of sending them")
+	flag.IntVar(&cfg.Agent.Drafts, "drafts", cfg.Agent.Drafts, "number of candidate drafts to request in copilot mode")
+	flag.StringVar(&cfg.Serve, "serve", cfg.Serve, "also accept customers over HTTP on this address, e.g. :8080")
+	flag.IntVar(&cfg.Agent.ContextWindow, "context-window", cfg.Agent.ContextWindow, "context window in tokens (default depends on -model)")
+	flag.StringVar(&cfg.Logs.EventLog, "event-log", cfg.Logs.EventLog, "append structured events to this JSONL file")
+	flag.StringVar(&cfg.Logs.UsageLog, "usage-log", cfg.Logs.UsageLog, "append the tokens and cost of every model call to this JSONL file")
+	flag.StringVar(&cfg.Logs.Prices, "prices", cfg.Logs.Prices, "JSON file of per model prices in dollars per 1000 tokens")
+	flag.Float64Var(&cfg.Agent.SessionBudget, "session-budget", cfg.Agent.SessionBudget, "escalate a session to a human once it has cost this many dollars (0 for no limit)")
+	flag.IntVar(&cfg.UI.Width, "width", cfg.UI.Width, "width of the TUI")
+	flag.IntVar(&cfg.UI.Height, "height", cfg.UI.Height, "height of the conversation panes")
+	flag.IntVar(&cfg.UI.CharLimit, "char-limit", cfg.UI.CharLimit, "maximum length of a typed message")
+	flag.Parse()
+
+	cfg.Provider.Temperature = float32(temperature)
+	cfg.Agent.ToolProtocol = clichat.ToolProtocol(protocol)
+	cfg.Agent.ResponseFormat = clichat.ResponseFormat(format)
+
+	store, err := clichat.NewSessionStore(cfg.Logs.SessionDir)
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(1)
+	}
+
+	if listSessions {
+		infos, err := store.List()
+		if err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(1)
+		}
+		for _, info := range infos {
+			fmt.Printf("%s\t%s\t%d messages\t%q\n", info.ID, info.UpdatedAt.Format(time.RFC3339), info.Messages, info.Preview)
+		}
+		return
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Println("fatal: invalid configuration:")
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	session := store.Create()
+	if resume != "" {
+		session, err = store.Open(resume)
+		if err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(1)
+		}
+	}
+
+	orderStore, err := clichat.NewOrderStore(cfg.Orders)
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(1)
+	}
+
+	tools := clichat.DefaultTools(orderStore)
+
+	policies, err := clichat.ParsePolicies(policySpec)
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(1)
+	}
+	for name, policy := range policies {
+		cfg.Tools[name] = policy
+	}
+	for name, policy := range cfg.Tools {
+		if err := tools.SetPolicy(name, policy); err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(1)
+		}
+	}
 
-	log.Println("Starting up...")
+	aiOpts := cfg.Agent.Options()
 
-	msgChan := make(chan clichat.MessageContext, 100)
-	backendChan := make(chan clichat.MessageContext, 100)
-	p := tea.NewProgram(clichat.InitialModel(msgChan, backendChan))
+	prompts, err := clichat.LoadPromptLibrary(cfg.Agent.PromptDir)
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(1)
+	}
+	if err := prompts.Check(aiOpts.Prompt, cfg.Agent.ResponseFormat); err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(1)
+	}
+	go prompts.Watch(context.Background(), time.Second)
+
+	aiOpts.Tools = tools
+	aiOpts.Prompts = prompts
+	if aiOpts.ContextWindow == 0 {
+		aiOpts.ContextWindow = clichat.ContextWindow(cfg.Provider.Model)
+	}
+
+	provider, err := clichat.NewProvider(cfg.Provider)
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(1)
+	}
+	if cfg.Provider.FallbackModel != "" {
+		fallback := cfg.Provider
+		fallback.Model = cfg.Provider.FallbackModel
+		if aiOpts.Fallback, err = clichat.NewProvider(fallback); err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(1)
+		}
+	}
+
+	events, err := clichat.OpenEventLog(cfg.Logs.EventLog)
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(1)
+	}
+	defer events.Close()
+	log.SetOutput(events)
+	log.SetFlags(0)
+	aiOpts.Events = events
+
+	prices, err := clichat.LoadPriceTable(cfg.Logs.Prices)
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(1)
+	}
+	ledger, err := clichat.OpenLedger(cfg.Logs.UsageLog, prices)
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(1)
+	}
+	defer ledger.Close()
+	aiOpts.Ledger = ledger
+
+	bus := clichat.NewBus()
+	defer bus.Close()
+	events.Follow(bus)
+	backend := clichat.NewBackend(tools).WithEventLog(events)
+
+	if evalCases != "" {
+		passed, err := runEval(evalCases, evalReport, provider, aiOpts)
+		if err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(1)
+		}
+		if !passed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if batch != "" {
+		if err := runBatch(batch, transcript, provider, backend, aiOpts, bus); err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	go clichat.NewAIClient(p, msgChan, backendChan).Run()
-	go clichat.NewBackend(p, msgChan, backendChan).Run()
+	log.Println("Starting up session", session.ID)
+
+	model := clichat.InitialModel(bus, store, session).WithUI(cfg.UI).WithPrompts(prompts, aiOpts.Prompt)
+
+	var server *clichat.ChatServer
+	if cfg.Serve != "" {
+		server = clichat.NewChatServer(store)
+		server.Follow(bus)
+	}
+
+	p := tea.NewProgram(model)
+
+	if server != nil {
+		go func() {
+			if err := server.ListenAndServe(cfg.Serve, p); err != nil {
+				log.Println("Chat server:", err)
+				p.Send(tea.Quit())
+			}
+		}()
+	}
+
+	go clichat.NewAIClient(p, provider, backend, aiOpts, bus).Run()
 
 	if _, err := p.Run(); err != nil {
 		log.Fatal(err)
 	}
+
+	for _, metrics := range bus.Metrics() {
+		log.Println("Bus", metrics)
+	}
+
+	fmt.Println("Session:", session.ID)
+}
+
+// configPath finds the -config flag before the other flags are defined, so
+// that the config file can supply their defaults.
+func configPath(args []string) string {
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+
+	if path, ok := os.LookupEnv("CLICHAT_CONFIG"); ok {
+		return path
+	}
+	if _, err := os.Stat("clichat.yaml"); err == nil {
+		return "clichat.yaml"
+	}
+	return ""
+}
+
+func runBatch(path string, transcript string, provider clichat.Provider, backend *clichat.Backend, aiOpts clichat.AIClientOptions, bus *clichat.Bus) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	turns, err := clichat.ReadTurns(in)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if transcript != "" {
+		out, err = os.Create(transcript)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+
+	h := clichat.NewHeadless(bus, out)
+	go clichat.NewAIClient(h, provider, backend, aiOpts, bus).Run()
+
+	return h.Run(turns)
+}
+
+func runEval(path string, reportPath string, provider clichat.Provider, aiOpts clichat.AIClientOptions) (bool, error) {
+	cases, err := clichat.LoadEvalCases(path)
+	if err != nil {
+		return false, err
+	}
+
+	report := clichat.NewEvaluator(provider, aiOpts).Run(context.Background(), cases)
+	report.WriteScorecard(os.Stdout)
+
+	if reportPath != "" {
+		bts, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return false, err
+		}
+		if err := os.WriteFile(reportPath, bts, 0o644); err != nil {
+			return false, err
+		}
+	}
+
+	return report.Passed == report.Total, nil
+}
+
+// runLog implements `clichat log`: it filters the event log and prints it
+// one event per line.
+func runLog(args []string) error {
+	fs := flag.NewFlagSet("log", flag.ExitOnError)
+	path := fs.String("file", "events.jsonl", "event log to read")
+	session := fs.String("session", "", "only show events for this session id")
+	turn := fs.Int("turn", 0, "only show events for this turn")
+	types := fs.String("type", "", "comma separated event types to show, e.g. prompt,completion")
+	raw := fs.Bool("json", false, "print matching events as JSON lines")
+	fs.Parse(args)
+
+	filter := clichat.EventFilter{SessionID: *session, Turn: *turn}
+	for _, t := range strings.Split(*types, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			filter.Types = append(filter.Types, clichat.EventType(t))
+		}
+	}
+
+	f, err := os.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	events, err := clichat.ReadEvents(f, filter)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, e := range events {
+		if *raw {
+			enc.Encode(e)
+			continue
+		}
+		fmt.Println(clichat.FormatEvent(e))
+	}
+	return nil
+}
+
+// runUsage implements `clichat usage`: it totals the usage ledger per day
+// or per session.
+func runUsage(args []string) error {
+	fs := flag.NewFlagSet("usage", flag.ExitOnError)
+	path := fs.String("file", "usage.jsonl", "usage ledger to read")
+	by := fs.String("by", "day", "group totals by day or session")
+	fs.Parse(args)
+
+	if *by != "day" && *by != "session" {
+		return fmt.Errorf("unknown grouping %q: want day or session", *by)
+	}
+
+	f, err := os.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	records, err := clichat.ReadUsage(f)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{}
+	totals := map[string]*clichat.UsageTotals{}
+	var all clichat.UsageTotals
+	for _, r := range records {
+		key := r.Time.Local().Format("2006-01-02")
+		if *by == "session" {
+			key = r.SessionID
+		}
+		if totals[key] == nil {
+			keys = append(keys, key)
+			totals[key] = &clichat.UsageTotals{}
+		}
+		totals[key].Add(r)
+		all.Add(r)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		printUsage(key, *totals[key])
+	}
+	printUsage("total", all)
+	return nil
+}
+
+// printUsage prints one line of the usage report. Totals that include
+// estimated calls are marked with a ~.
+func printUsage(key string, t clichat.UsageTotals) {
+	approx := ""
+	if t.EstimatedCalls > 0 {
+		approx = "~"
+	}
+	fmt.Printf("%s\t%d calls\t%s%d tokens\t%s$%.4f", key, t.Calls, approx, t.TotalTokens, approx, t.Cost)
+	if t.EstimatedCalls > 0 {
+		fmt.Printf("\t(%d estimated)", t.EstimatedCalls)
+	}
+	fmt.Println()
 }
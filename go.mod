@@ -8,7 +8,8 @@ require (
 	github.com/charmbracelet/glamour v0.6.0
 	github.com/charmbracelet/lipgloss v0.7.1
 	github.com/muesli/reflow v0.3.0
-	github.com/sashabaranov/go-openai v1.9.0
+	github.com/sashabaranov/go-openai v1.24.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
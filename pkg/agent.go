@@ -2,108 +2,589 @@ package clichat
 
 import (
 	"context"
-	"log"
-	"os"
+	"errors"
+	"fmt"
+	"text/template"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/sashabaranov/go-openai"
 )
 
+const (
+	DefaultMaxSteps        = 5
+	DefaultTimeout         = 2 * time.Minute
+	DefaultApprovalTimeout = 10 * time.Minute
+)
+
+// errRunTimeout ends a run that used up AIClientOptions.Timeout.
+var errRunTimeout = fmt.Errorf("agent run %w", context.DeadlineExceeded)
+
+// StopReason explains why an agent run ended.
+type StopReason string
+
+const (
+	StopReplied   StopReason = "replied"
+	StopToolReply StopReason = "tool replied"
+	StopNoAction  StopReason = "no action"
+	StopMaxSteps  StopReason = "step limit reached"
+	StopTimeout   StopReason = "timed out"
+	StopError     StopReason = "error"
+	StopBudget    StopReason = "budget exceeded"
+	StopCancelled StopReason = "cancelled"
+	// StopUnavailable means the model could not be reached, even after
+	// retries and the fallback model, and a human took over.
+	StopUnavailable StopReason = "AI unavailable"
+	// StopLowConfidence means the model was less sure of its next step than
+	// AIClientOptions.MinConfidence.
+	StopLowConfidence StopReason = "low confidence"
+)
+
+// ErrCancelled is the cause of a run that was abandoned, because the
+// customer sent a newer message or the operator cancelled it.
+var ErrCancelled = errors.New("cancelled")
+
+var (
+	errNewerMessage      = fmt.Errorf("%w: the customer sent a newer message", ErrCancelled)
+	errOperatorCancelled = fmt.Errorf("%w by the operator", ErrCancelled)
+)
+
+type (
+	// agentStartedMsg is sent when a run starts answering a customer
+	// message. Cancel abandons it.
+	agentStartedMsg struct {
+		Turn   int
+		cancel context.CancelCauseFunc
+	}
+
+	// agentStepMsg is sent to the Model at the start of every reason → act →
+	// observe iteration and agentStoppedMsg once the run is over.
+	agentStepMsg struct {
+		Step int
+		Max  int
+	}
+
+	agentStoppedMsg struct {
+		Reason StopReason
+		Steps  int
+	}
+
+	// confidenceMsg is the confidence the model gave for its latest step.
+	confidenceMsg float64
+)
+
+func (m agentStartedMsg) Cancel() {
+	m.cancel(errOperatorCancelled)
+}
+
+// turnRequest is a customer message waiting for a worker. ctx is cancelled
+// once a newer message arrives for the same session.
+type turnRequest struct {
+	ctx    context.Context
+	msgCtx MessageContext
+}
+
+type AIClientOptions struct {
+	// Prompt names the default template in Prompts used with
+	// ProtocolReAct.
+	Prompt   string
+	Prompts  *PromptLibrary
+	Protocol ToolProtocol
+	// MinConfidence escalates to a human when the model reports a lower
+	// confidence for its next step. Zero disables the check.
+	MinConfidence float64
+	Tools         *ToolRegistry
+	MaxSteps      int
+	// Timeout bounds a whole run and CallTimeout each model call within
+	// it. Calls failing with rate limits, server errors or timeouts are
+	// retried Retries times before Fallback, if set, is tried.
+	Timeout     time.Duration
+	CallTimeout time.Duration
+	Retries     int
+	Fallback    Provider
+	// ApprovalTimeout is how long an action waits for the operator. The
+	// wait does not count against Timeout, and an action that is not
+	// decided in time is treated as rejected.
+	ApprovalTimeout time.Duration
+	// Copilot holds Agent replies back as drafts for the operator instead
+	// of sending them to the customer. Drafts is how many candidates to ask
+	// the model for.
+	Copilot bool
+	Drafts  int
+	// ContextWindow is the model's context window in tokens. Older history
+	// is compacted to keep prompts within it.
+	ContextWindow int
+	// Ledger prices every model call. When a session has cost more than
+	// SessionBudget dollars it is escalated to a human. Zero means no
+	// budget.
+	Ledger        *Ledger
+	SessionBudget float64
+	// Events records prompts, completions, actions and errors. May be nil.
+	Events *EventLog
+}
+
+// Sender receives the tea.Msgs produced by the AIClient. *tea.Program is the
+// usual implementation.
+type Sender interface {
+	Send(msg tea.Msg)
+}
+
 type AIClient struct {
-	program         *tea.Program
-	client          *openai.Client
-	msgChan         chan MessageContext
-	lastUserMessage string
+	program  Sender
+	provider Provider
+	backend  *Backend
+	opts     AIClientOptions
+	customer *Subscription
 }
 
-func NewAIClient(p *tea.Program, msgChan chan MessageContext, backendChan chan MessageContext) *AIClient {
+// agentRun is a single Chat call. Everything it sends is tagged with the
+// session it belongs to.
+type agentRun struct {
+	*AIClient
+	sessionID string
+	prompt    string
+	out       Sender
+	// clock times the run out. It is paused while an action waits for the
+	// operator.
+	clock *runClock
+}
+
+// runClock cancels a run once it has used up its time, not counting the
+// time it was paused.
+type runClock struct {
+	timer     *time.Timer
+	deadline  time.Time
+	remaining time.Duration
+	paused    bool
+}
+
+func startRunClock(timeout time.Duration, cancel context.CancelCauseFunc) *runClock {
+	return &runClock{
+		timer:    time.AfterFunc(timeout, func() { cancel(errRunTimeout) }),
+		deadline: time.Now().Add(timeout),
+	}
+}
+
+// pause stops the clock unless it already ran out. A nil clock does
+// nothing.
+func (c *runClock) pause() {
+	if c == nil || c.paused || !c.timer.Stop() {
+		return
+	}
+	c.remaining = time.Until(c.deadline)
+	c.paused = true
+}
+
+func (c *runClock) resume() {
+	if c == nil || !c.paused {
+		return
+	}
+	c.deadline = time.Now().Add(c.remaining)
+	c.timer.Reset(c.remaining)
+	c.paused = false
+}
+
+func (c *runClock) stop() {
+	if c != nil {
+		c.timer.Stop()
+	}
+}
+
+// sessionSender wraps every msg in a sessionMsg before passing it on.
+type sessionSender struct {
+	sessionID string
+	program   Sender
+}
+
+func (s sessionSender) Send(msg tea.Msg) {
+	s.program.Send(sessionMsg{SessionID: s.sessionID, Msg: msg})
+}
+
+// NewAIClient answers the CustomerSaid events published on bus.
+func NewAIClient(p Sender, provider Provider, backend *Backend, opts AIClientOptions, bus *Bus) *AIClient {
+	if opts.Prompt == "" {
+		opts.Prompt = DefaultPrompt
+	}
+	if opts.Prompts == nil {
+		opts.Prompts, _ = LoadPromptLibrary("")
+	}
+	if opts.Protocol == "" {
+		opts.Protocol = ProtocolReAct
+	}
+	if opts.Tools == nil {
+		opts.Tools = DefaultTools(NewMemoryOrderStore(demoOrders))
+	}
+	if opts.MaxSteps <= 0 {
+		opts.MaxSteps = DefaultMaxSteps
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.CallTimeout <= 0 {
+		opts.CallTimeout = DefaultCallTimeout
+	}
+	if opts.ApprovalTimeout <= 0 {
+		opts.ApprovalTimeout = DefaultApprovalTimeout
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	}
+	if opts.ContextWindow <= 0 {
+		opts.ContextWindow = DefaultContextWindow
+	}
 	return &AIClient{
-		program: p,
-		client:  openai.NewClient(os.Getenv("OPENAI_API_KEY")),
-		msgChan: msgChan,
+		program:  p,
+		provider: provider,
+		backend:  backend,
+		opts:     opts,
+		customer: bus.Subscribe("agent", 100, Only(CustomerSaid{})),
 	}
 }
 
+// Run hands customer messages to one worker per session so conversations
+// are served concurrently while each one is handled in order. A newer
+// customer message cancels the run still answering an older one.
 func (a *AIClient) Run() {
-	for msgCtx := range a.msgChan {
-		if msgCtx.Current.Sender == "You" || msgCtx.Current.Sender == "Backend" {
-			a.Chat(msgCtx)
+	workers := map[string]chan turnRequest{}
+	cancels := map[string]context.CancelCauseFunc{}
+	for e := range a.customer.Events() {
+		msgCtx := e.(CustomerSaid).MessageContext
+
+		if cancel, ok := cancels[msgCtx.SessionID]; ok {
+			cancel(errNewerMessage)
 		}
+		ctx, cancel := context.WithCancelCause(context.Background())
+		cancels[msgCtx.SessionID] = cancel
+
+		queue, ok := workers[msgCtx.SessionID]
+		if !ok {
+			queue = make(chan turnRequest, 100)
+			workers[msgCtx.SessionID] = queue
+			go a.serve(queue)
+		}
+		queue <- turnRequest{ctx: ctx, msgCtx: msgCtx}
+	}
+
+	for id, queue := range workers {
+		cancels[id](nil)
+		close(queue)
 	}
 }
 
-func (a *AIClient) Chat(msgCtx MessageContext) {
-	lastUserMessage := getLastUserMessage(msgCtx.History)
-	if lastUserMessage == a.lastUserMessage {
-		return
+func (a *AIClient) serve(queue chan turnRequest) {
+	var conversation *Conversation
+	for req := range queue {
+		// The first message of a resumed session carries its history.
+		if conversation == nil {
+			conversation = restoreConversation(req.msgCtx.History)
+		}
+		// Messages that were overtaken while queued are answered as part
+		// of the newer one.
+		if req.ctx.Err() != nil {
+			continue
+		}
+		a.Chat(req.ctx, conversation, req.msgCtx)
 	}
+}
 
-	a.lastUserMessage = lastUserMessage
+// Chat runs the agent loop for a new customer message. Each step asks the
+// model what to do, executes the chosen action and feeds the observation
+// back until the model replies to the customer, a limit is hit or ctx is
+// cancelled.
+func (a *AIClient) Chat(ctx context.Context, conversation *Conversation, msgCtx MessageContext) {
+	r := &agentRun{AIClient: a, sessionID: msgCtx.SessionID, prompt: msgCtx.Prompt, out: sessionSender{sessionID: msgCtx.SessionID, program: a.program}}
+	if r.prompt == "" {
+		r.prompt = a.opts.Prompt
+	}
 
-	prmt := GenerateConvesationalPrompt(tools, msgCtx.History)
+	turn := msgCtx.Turn
+	if turn == 0 {
+		turn = customerTurns(msgCtx.History)
+	}
+	ctx = WithTurn(WithConversation(ctx, conversation), msgCtx.SessionID, turn)
+	ctx, cancelRun := context.WithCancelCause(ctx)
+	defer cancelRun(nil)
+	r.out.Send(agentStartedMsg{Turn: turn, cancel: cancelRun})
 
-	resp, err := a.client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			// Model: openai.GPT3Dot5Turbo,
-			Model:       openai.GPT4,
-			Temperature: 0.3,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prmt,
-				},
-			},
-		},
-	)
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	r.clock = startRunClock(a.opts.Timeout, cancel)
+	defer r.clock.stop()
 
-	log.Printf("AI prompt: %q", prmt)
+	history := append([]Message{}, msgCtx.History...)
 
-	if err != nil {
-		a.program.Send(errMsg(err))
+	step := 0
+	reason := StopMaxSteps
+	for step < a.opts.MaxSteps {
+		if r.overBudget() {
+			reason = StopBudget
+			if err := r.escalate(ctx, reason); err != nil {
+				r.out.Send(errMsg(err))
+			}
+			break
+		}
+
+		step++
+		r.out.Send(agentStepMsg{Step: step, Max: a.opts.MaxSteps})
+
+		msgs, stop, err := r.step(ctx, history)
+		history = append(history, msgs...)
+
+		if cause := context.Cause(ctx); errors.Is(cause, ErrCancelled) {
+			reason = StopCancelled
+			r.out.Send(Message{Sender: RoleCancelled, Text: cause.Error()})
+			break
+		}
+		if errors.Is(err, ErrAIUnavailable) {
+			reason = StopUnavailable
+			a.opts.Events.Record(ctx, Event{Type: EventError, Error: err.Error()})
+			if err := r.escalate(ctx, reason); err != nil {
+				r.out.Send(errMsg(err))
+			}
+			break
+		}
+		if err != nil {
+			reason = StopError
+			if cause := context.Cause(ctx); errors.Is(cause, context.DeadlineExceeded) {
+				reason = StopTimeout
+				err = cause
+			}
+			a.opts.Events.Record(ctx, Event{Type: EventError, Error: err.Error()})
+			r.out.Send(errMsg(err))
+			break
+		}
+
+		if stop != "" {
+			reason = stop
+			break
+		}
 	}
 
-	aiResp := resp.Choices[0].Message.Content
-	log.Printf("AI response: %q", aiResp)
+	a.opts.Events.Record(ctx, Event{Type: EventStopped, Text: string(reason), Steps: step})
+	r.out.Send(agentStoppedMsg{Reason: reason, Steps: step})
+}
+
+// step performs one reason → act → observe iteration. It returns the
+// messages it produced and a stop reason when the run should end.
+func (r *agentRun) step(ctx context.Context, history []Message) (Messages, StopReason, error) {
+	req := r.fit(ctx, history)
+	r.opts.Events.Record(ctx, Event{Type: EventPrompt, Prompt: r.prompt, Text: req.Prompt})
+
+	start := time.Now()
+	resp, err := r.complete(ctx, req)
+	if err != nil {
+		return nil, "", err
+	}
+	// A completion that finished just as the run was cancelled is stale.
+	if ctx.Err() != nil {
+		return nil, "", context.Cause(ctx)
+	}
 
-	nextAction := ParseResponse(aiResp)
-	log.Printf("AI next action: %#v", nextAction)
+	usage := r.account(req, resp)
+	nextAction := r.parse(r.prompt, resp)
+	r.opts.Events.Record(ctx, Event{Type: EventCompletion, Text: resp.Text, Latency: time.Since(start), Usage: &usage, Confidence: nextAction.Confidence})
+	if nextAction.Confidence != nil {
+		r.out.Send(confidenceMsg(*nextAction.Confidence))
+	}
 
 	msgs := Messages{}
 
-	if nextAction.Agent != "" {
+	if nextAction.Thought != "" {
 		msgs = append(msgs, Message{
-			Sender: "Agent",
-			Text:   nextAction.Agent,
+			Sender: RoleThought,
+			Text:   nextAction.Thought,
 		})
 	}
 
-	if nextAction.Action != "" {
+	if c := nextAction.Confidence; c != nil && *c < r.opts.MinConfidence {
+		msgs = r.deliver(msgs)
+		return msgs, StopLowConfidence, r.escalate(ctx, StopLowConfidence)
+	}
+
+	if nextAction.Agent != "" {
 		msgs = append(msgs, Message{
-			Sender: "Action",
-			Text:   nextAction.Action,
-			Input:  nextAction.ActionInput,
+			Sender: RoleAgent,
+			Text:   nextAction.Agent,
 		})
 	}
 
-	if nextAction.Thought != "" {
-		msgs = append(msgs, Message{
-			Sender: "Thought",
-			Text:   nextAction.Thought,
+	if nextAction.Action == "" {
+		alternatives := []string{}
+		for _, alt := range resp.Alternatives {
+			alternatives = append(alternatives, r.parse(r.prompt, Completion{Text: alt}).Agent)
+		}
+
+		msgs = r.deliver(msgs, alternatives...)
+		if nextAction.Agent != "" {
+			return msgs, StopReplied, nil
+		}
+		return msgs, StopNoAction, nil
+	}
+
+	action := Message{
+		Sender: RoleAction,
+		Text:   nextAction.Action,
+		Input:  nextAction.ActionInput,
+	}
+	msgs = append(r.deliver(msgs), action)
+	r.out.Send(action)
+
+	approved, refusal, err := r.authorize(ctx, action)
+	if err != nil {
+		return msgs, "", err
+	}
+	if refusal != nil {
+		r.out.Send(*refusal)
+		return append(msgs, *refusal), "", nil
+	}
+	if approved.Input != action.Input {
+		edit := Message{Sender: RoleObservation, Text: fmt.Sprintf("The operator changed the input to %q.", approved.Input)}
+		r.out.Send(edit)
+		msgs = append(msgs, edit)
+	}
+
+	observations, err := r.backend.Chat(ctx, approved)
+	if err != nil {
+		return msgs, "", fmt.Errorf("%s: %w", action.Text, err)
+	}
+
+	replied := false
+	for _, obs := range observations {
+		if obs.Sender == RoleAgent {
+			replied = true
+		}
+	}
+
+	msgs = append(msgs, r.deliver(observations)...)
+	if replied {
+		return msgs, StopToolReply, nil
+	}
+
+	return msgs, "", nil
+}
+
+// account records the cost of a model call and reports the running totals
+// to the Model. Usage is estimated when the provider did not report it.
+func (r *agentRun) account(req CompletionRequest, resp Completion) Usage {
+	usage := resp.Usage
+	if usage.TotalTokens == 0 {
+		usage = Usage{
+			PromptTokens:     requestTokens(req),
+			CompletionTokens: EstimateTokens(resp.Text),
+			Estimated:        true,
+		}
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+
+	if r.opts.Ledger != nil {
+		call := r.opts.Ledger.Add(r.sessionID, resp.Model, usage)
+		r.out.Send(usageMsg{
+			Call:    call,
+			Session: r.opts.Ledger.Session(r.sessionID),
+			Day:     r.opts.Ledger.Day(call.Time),
 		})
 	}
 
-	log.Printf("Sending messages: %#v", msgs)
+	return usage
+}
 
-	a.program.Send(msgs)
+func (r *agentRun) overBudget() bool {
+	return r.opts.SessionBudget > 0 && r.opts.Ledger.Session(r.sessionID).Cost >= r.opts.SessionBudget
 }
 
-func getLastUserMessage(msgs []Message) string {
-	out := ""
+// escalate hands the conversation to a human without asking the model.
+func (r *agentRun) escalate(ctx context.Context, reason StopReason) error {
+	action := Message{Sender: RoleAction, Text: escalationAction}
+	r.out.Send(action)
+
+	observations, err := r.backend.Chat(ctx, action)
+	if err != nil {
+		return err
+	}
+	r.deliver(observations)
+	return nil
+}
+
+// deliver sends msgs to the Model and returns the ones that joined the
+// conversation. In copilot mode Agent replies, plus any alternatives, are
+// offered to the operator as drafts instead.
+func (r *agentRun) deliver(msgs Messages, alternatives ...string) Messages {
+	if !r.opts.Copilot {
+		r.out.Send(msgs)
+		return msgs
+	}
+
+	out := Messages{}
+	drafts := []string{}
 	for _, msg := range msgs {
-		if msg.Sender == "You" {
-			out = msg.Text
+		if msg.Sender == RoleAgent {
+			drafts = appendDraft(drafts, msg.Text)
+		} else {
+			out = append(out, msg)
+		}
+	}
+	if len(drafts) > 0 {
+		for _, alt := range alternatives {
+			drafts = appendDraft(drafts, alt)
 		}
 	}
+
+	r.out.Send(out)
+	if len(drafts) > 0 {
+		r.out.Send(draftsMsg{Drafts: drafts})
+	}
+
 	return out
 }
+
+func appendDraft(drafts []string, draft string) []string {
+	if draft == "" {
+		return drafts
+	}
+	for _, d := range drafts {
+		if d == draft {
+			return drafts
+		}
+	}
+	return append(drafts, draft)
+}
+
+// template returns the named prompt template, falling back to the default
+// prompt if it no longer exists.
+func (a *AIClient) template(prompt string) *template.Template {
+	tmpl, ok := a.opts.Prompts.Get(prompt)
+	if !ok {
+		tmpl, ok = a.opts.Prompts.Get(a.opts.Prompt)
+	}
+	if !ok {
+		tmpl = promtTemplate
+	}
+	return tmpl
+}
+
+// request builds the completion request for history using the named prompt
+// template.
+func (a *AIClient) request(prompt string, history []Message) CompletionRequest {
+	req := CompletionRequest{Prompt: renderPrompt(a.template(prompt), a.opts.Tools.Descriptions(), history)}
+	if a.opts.Protocol == ProtocolFunctions {
+		req = CompletionRequest{
+			Prompt: GenerateFunctionsPrompt(history),
+			Tools:  a.opts.Tools.Definitions(),
+		}
+	}
+
+	if a.opts.Copilot {
+		req.Candidates = a.opts.Drafts
+	}
+
+	return req
+}
+
+// parse reads resp in the response format of the prompt template that
+// produced it.
+func (a *AIClient) parse(prompt string, resp Completion) AiResponse {
+	if a.opts.Protocol == ProtocolFunctions {
+		return ParseToolCalls(resp)
+	}
+
+	return templateFormat(a.template(prompt)).Parse(resp.Text)
+}
@@ -0,0 +1,123 @@
+package clichat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ToolPolicy decides whether an action the model chose may run.
+type ToolPolicy string
+
+const (
+	PolicyAuto      ToolPolicy = "auto"
+	PolicyApprove   ToolPolicy = "approve"
+	PolicyForbidden ToolPolicy = "forbidden"
+)
+
+type (
+	// approvalRequestMsg asks the operator to approve, edit or reject an
+	// action. The decision is sent back on reply.
+	approvalRequestMsg struct {
+		Action Message
+		reply  chan approvalDecision
+	}
+
+	approvalDecision struct {
+		Approved bool
+		Input    string
+		// Expired is set when the operator did not decide in time.
+		Expired bool
+	}
+
+	// approvalExpiredMsg withdraws an approval request the operator did
+	// not decide on in time.
+	approvalExpiredMsg struct {
+		Action Message
+	}
+)
+
+func (r approvalRequestMsg) Approve(input string) {
+	r.reply <- approvalDecision{Approved: true, Input: input}
+}
+
+func (r approvalRequestMsg) Reject() {
+	r.reply <- approvalDecision{}
+}
+
+// ParsePolicies reads a comma separated list of Tool=policy pairs, e.g.
+// "ReturnOrderFlow=approve,CloseConversation=auto".
+func ParsePolicies(spec string) (map[string]ToolPolicy, error) {
+	policies := map[string]ToolPolicy{}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, policy, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid policy %q: want Tool=policy", pair)
+		}
+
+		switch p := ToolPolicy(strings.TrimSpace(policy)); p {
+		case PolicyAuto, PolicyApprove, PolicyForbidden:
+			policies[strings.TrimSpace(name)] = p
+		default:
+			return nil, fmt.Errorf("invalid policy %q for %s: want auto, approve or forbidden", policy, name)
+		}
+	}
+	return policies, nil
+}
+
+// requestApproval blocks until the operator decides on action, ApprovalTimeout
+// passes or ctx ends. The run's clock is paused meanwhile.
+func (r *agentRun) requestApproval(ctx context.Context, action Message) (approvalDecision, error) {
+	req := approvalRequestMsg{Action: action, reply: make(chan approvalDecision, 1)}
+	r.out.Send(req)
+
+	r.clock.pause()
+	defer r.clock.resume()
+
+	expired := time.NewTimer(r.opts.ApprovalTimeout)
+	defer expired.Stop()
+
+	select {
+	case decision := <-req.reply:
+		return decision, nil
+	case <-expired.C:
+		r.out.Send(approvalExpiredMsg{Action: action})
+		return approvalDecision{Expired: true}, nil
+	case <-ctx.Done():
+		return approvalDecision{}, ctx.Err()
+	}
+}
+
+// authorize applies the tool's policy to action. It returns the action to
+// execute, or a Backend observation explaining why it will not run.
+func (r *agentRun) authorize(ctx context.Context, action Message) (Message, *Message, error) {
+	policy := PolicyAuto
+	if tool, ok := r.opts.Tools.Get(action.Text); ok {
+		policy = tool.Policy
+	}
+
+	switch policy {
+	case PolicyForbidden:
+		return action, &Message{Sender: RoleObservation, Text: fmt.Sprintf("%s is not allowed. Choose another action.", action.Text)}, nil
+	case PolicyApprove:
+		decision, err := r.requestApproval(ctx, action)
+		if err != nil {
+			return action, nil, err
+		}
+		if decision.Expired {
+			return action, &Message{Sender: RoleObservation, Text: fmt.Sprintf("The operator did not approve %s with input %q in time.", action.Text, action.Input)}, nil
+		}
+		if !decision.Approved {
+			return action, &Message{Sender: RoleObservation, Text: fmt.Sprintf("The operator rejected %s with input %q.", action.Text, action.Input)}, nil
+		}
+		action.Input = decision.Input
+	}
+
+	return action, nil, nil
+}
@@ -0,0 +1,52 @@
+package clichat
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// An action the operator leaves undecided must outlast the run timeout and
+// then go back to the model as a rejection.
+func TestApprovalExpires(t *testing.T) {
+	provider := NewScriptedProvider(
+		"Thought: The customer confirmed\nAction: ReturnOrderFlow\nAction Input: 123456",
+		"Agent: I could not start the return, a colleague will follow up.",
+	)
+	program := &recordingSender{}
+	ai := NewAIClient(program, provider, NewBackend(DefaultTools(NewMemoryOrderStore(demoOrders))), AIClientOptions{
+		Timeout:         50 * time.Millisecond,
+		ApprovalTimeout: 150 * time.Millisecond,
+	}, nil)
+
+	ai.Chat(context.Background(), &Conversation{}, MessageContext{
+		SessionID: "s",
+		Current:   Message{Sender: RoleCustomer, Text: "Yes, return 123456"},
+		History:   []Message{{Sender: RoleCustomer, Text: "Yes, return 123456"}},
+	})
+
+	var expired, rejected bool
+	var stopped agentStoppedMsg
+	for _, msg := range program.sent() {
+		switch msg := msg.(sessionMsg).Msg.(type) {
+		case approvalExpiredMsg:
+			expired = true
+		case Message:
+			if msg.Sender == RoleObservation && strings.Contains(msg.Text, "in time") {
+				rejected = true
+			}
+		case errMsg:
+			t.Errorf("run failed: %v", msg)
+		case agentStoppedMsg:
+			stopped = msg
+		}
+	}
+
+	if !expired || !rejected {
+		t.Errorf("approval expired %v, rejection sent to the model %v, want both", expired, rejected)
+	}
+	if stopped.Reason != StopReplied {
+		t.Errorf("run stopped with %q, want %q", stopped.Reason, StopReplied)
+	}
+}
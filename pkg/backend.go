@@ -1,44 +1,14 @@
 package clichat
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-
-	tea "github.com/charmbracelet/bubbletea"
+	"strings"
+	"time"
 )
 
-var orders = []order{
-	{
-		OrderNumber: "123456",
-		Items: []orderItem{
-			{
-				ProductDesc: "Brown Pants",
-				Quantity:    1,
-			},
-			{
-				ProductDesc: "Purple shirt",
-				Quantity:    1,
-			},
-		},
-		OrderDate: "2021-01-01",
-	},
-	{
-		OrderNumber: "654321",
-		Items: []orderItem{
-			{
-				ProductDesc: "Green underwear",
-				Quantity:    1,
-			},
-			{
-				ProductDesc: "Red socks",
-				Quantity:    1,
-			},
-		},
-		OrderDate: "2023-04-10",
-	},
-}
-
 var me = user{
 	FirstName: "James",
 	LastName:  "Pozdena",
@@ -46,111 +16,167 @@ var me = user{
 	Phone:     "5033480170",
 }
 
-type Backend struct {
-	program     *tea.Program
-	msgChan     chan MessageContext
-	backendChan chan MessageContext
-}
+// DefaultTools returns the registry of tools backed by the given order
+// store.
+func DefaultTools(store OrderStore) *ToolRegistry {
+	r := NewToolRegistry()
+
+	r.Register(Tool{
+		Name:        "CustomerLookup",
+		Description: "Finds a customer's profile. Useful when you need to identify who you are talking to. Input should be the customer's email address, phone number or full name.",
+		Handler:     customerLookup(demoCustomers),
+	})
+	r.Register(Tool{
+		Name:        "OrderSearch",
+		Description: "A search engine for orders. Useful for when you need to answer questions about current events. Input should be an order id, email address or customer's phone number. Leave it empty to search the customer found with CustomerLookup.",
+		Handler:     orderSearch(store),
+	})
+	r.Register(Tool{
+		Name:        "ReturnOrderFlow",
+		Description: "Initiates a order return. Useful when the customer is trying to return an item and the order number is known. Input should be a order id that is confirmed by the customer.",
+		Handler:     returnOrderFlow(store),
+		Policy:      PolicyApprove,
+	})
+	r.Register(Tool{
+		Name:        "EscalateToHuman",
+		Description: "Escalates chat to a human. Useful when the customer is confused or you do not know what to do next",
+		Handler: func(ctx context.Context, input string) (Observation, error) {
+			return Observation{Reply: "I'll transfer you to a human agent"}, nil
+		},
+	})
+	r.Register(Tool{
+		Name:        "CloseConversation",
+		Description: "Closes the conversation. Useful when the customer is done talking to the agent",
+		Policy:      PolicyApprove,
+		Handler: func(ctx context.Context, input string) (Observation, error) {
+			return Observation{Reply: "Goodbye"}, nil
+		},
+	})
+	r.Register(Tool{
+		Name:   "Chat",
+		Hidden: true,
+		Handler: func(ctx context.Context, input string) (Observation, error) {
+			return Observation{Reply: input}, nil
+		},
+	})
 
-func NewBackend(p *tea.Program, msgChan chan MessageContext, backendChan chan MessageContext) *Backend {
-	return &Backend{
-		program:     p,
-		msgChan:     msgChan,
-		backendChan: backendChan,
-	}
+	return r
 }
 
-func (a *Backend) Run() {
-	for msgCtx := range a.backendChan {
-		log.Printf("Backend received message: %#v %d\n", msgCtx.Current, len(a.backendChan))
-		if msgCtx.Current.Sender == "Action" {
-			a.Chat(msgCtx.Current)
+func orderSearch(store OrderStore) ToolHandler {
+	return func(ctx context.Context, input string) (Observation, error) {
+		input = strings.TrimSpace(input)
+		if input == "" {
+			if c := ConversationFrom(ctx); c != nil && c.Customer() != nil {
+				input = c.Customer().Email
+				if input == "" {
+					input = c.Customer().Phone
+				}
+			}
 		}
-	}
-}
 
-func (a *Backend) Chat(msg Message) {
-	action := msg.Text
-	input := msg.Input
+		results := orderResults{
+			ResultsFor: "lookup_order_by_order_number",
+			LookupBy:   input,
+			Orders:     []Order{},
+		}
 
-	log.Println("Backend Action:", action)
-
-	switch action {
-	case "Chat":
-		a.program.Send(Message{Sender: "Agent", Text: input})
-	case "OrderSearch":
-		if input == "jpozdena@gmail.com" {
-			orderJson, err := json.MarshalIndent(orderResults{
-				ResultsFor: "lookup_orders_by_email",
-				LookupBy:   input,
-				Orders:     orders,
-			}, "", "  ")
+		if strings.Contains(input, "@") {
+			results.ResultsFor = "lookup_orders_by_email"
+			orders, err := store.OrdersByEmail(ctx, input)
 			if err != nil {
-				a.program.Send(errMsg(err))
-				return
+				return Observation{}, err
 			}
-
-			a.program.Send(Message{Sender: "Backend", Text: string(orderJson)})
-
-			return
-		} else if input == "5033480170" {
-			orderJson, err := json.MarshalIndent(orderResults{
-				ResultsFor: "lookup_orders_by_phone_number",
-				LookupBy:   input,
-				Orders:     orders,
-			}, "", "  ")
+			results.Orders = orders
+		} else if o, err := store.OrderByNumber(ctx, input); err == nil {
+			results.Orders = []Order{o}
+		} else if !errors.Is(err, ErrOrderNotFound) {
+			return Observation{}, err
+		} else if len(normalizePhone(input)) >= 10 {
+			results.ResultsFor = "lookup_orders_by_phone_number"
+			orders, err := store.OrdersByPhone(ctx, input)
 			if err != nil {
-				a.program.Send(errMsg(err))
-				return
+				return Observation{}, err
 			}
+			results.Orders = orders
+		}
 
-			a.program.Send(Message{Sender: "Backend", Text: string(orderJson)})
-
-			return
+		orderJson, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return Observation{}, err
 		}
 
-		for _, o := range orders {
-			if o.OrderNumber == input {
-				orderJson, err := json.MarshalIndent(orderResults{
-					ResultsFor: "lookup_order_by_order_number",
-					LookupBy:   input,
-					Orders:     []order{o},
-				}, "", "  ")
-				if err != nil {
-					a.program.Send(errMsg(err))
-					return
-				}
+		return Observation{Text: string(orderJson)}, nil
+	}
+}
 
-				a.program.Send(Message{Sender: "Backend", Text: string(orderJson)})
-				return
-			}
+func returnOrderFlow(store OrderStore) ToolHandler {
+	return func(ctx context.Context, input string) (Observation, error) {
+		input = strings.TrimSpace(input)
+
+		err := store.InitiateReturn(ctx, input)
+		switch {
+		case errors.Is(err, ErrOrderNotFound):
+			return Observation{Text: fmt.Sprintf(`Invalid order number: %s`, input)}, nil
+		case errors.Is(err, ErrAlreadyReturned):
+			return Observation{Text: fmt.Sprintf("A return was already started for order %s", input)}, nil
+		case err != nil:
+			return Observation{}, err
 		}
 
-		orderJson, err := json.MarshalIndent(orderResults{
-			ResultsFor: "lookup_orders_by_email",
-			LookupBy:   input,
-			Orders:     []order{},
-		}, "", "  ")
-		if err != nil {
-			a.program.Send(errMsg(err))
-			return
-		}
+		return Observation{
+			Text:  fmt.Sprintf("Return instructions sent for order %s", input),
+			Reply: fmt.Sprintf("Return instructions have been sent for %s. They should be in your email inbox within the hour", input),
+		}, nil
+	}
+}
 
-		a.program.Send(Message{Sender: "Backend", Text: string(orderJson)})
-	case "ReturnOrderFlow":
-		if input == "123456" {
-			a.program.Send(
-				Messages{
-					Message{Sender: "Backend", Text: fmt.Sprintf("Retrun instructions sent for order %s", input)},
-					Message{Sender: "Agent", Text: fmt.Sprintf("Return instructions have been sent for %s. The should be in your email inbox within the hour", input)},
-				},
-			)
-			return
-		}
-		a.program.Send(Message{Sender: "Backend", Text: fmt.Sprintf(`Invalid order number: %s`, input)})
-	case "CloseConversation":
-		a.program.Send(Message{Sender: "Agent", Text: "Goodbye"})
-	case "EscalateToHuman":
-		a.program.Send(Message{Sender: "Agent", Text: "I'll transfer you to a human agent"})
+type Backend struct {
+	tools  *ToolRegistry
+	events *EventLog
+}
+
+func NewBackend(tools *ToolRegistry) *Backend {
+	return &Backend{
+		tools: tools,
 	}
 }
+
+// WithEventLog records unknown and failed actions to l.
+func (a *Backend) WithEventLog(l *EventLog) *Backend {
+	a.events = l
+	return a
+}
+
+// Chat executes an Action message and returns the resulting Backend
+// observation and any Agent reply.
+func (a *Backend) Chat(ctx context.Context, msg Message) (Messages, error) {
+	action := msg.Text
+	input := msg.Input
+
+	tool, ok := a.tools.Get(action)
+	if !ok {
+		a.events.Record(ctx, Event{Type: EventError, Sender: action, Input: input, Error: "unknown action"})
+		return Messages{{Sender: RoleObservation, Text: fmt.Sprintf("Unknown action: %s", action)}}, nil
+	}
+
+	start := time.Now()
+	obs, err := tool.Handler(ctx, input)
+	if err != nil {
+		a.events.Record(ctx, Event{Type: EventError, Sender: action, Input: input, Latency: time.Since(start), Error: err.Error()})
+		return nil, err
+	}
+
+	msgs := Messages{}
+	if obs.Text != "" {
+		msgs = append(msgs, Message{Sender: RoleObservation, Text: obs.Text})
+	}
+	if u := obs.Customer; u != nil {
+		msgs = append(msgs, Message{Sender: RoleIdentified, Text: fmt.Sprintf("%s %s <%s>", u.FirstName, u.LastName, u.Email), Customer: u})
+	}
+	if obs.Reply != "" {
+		msgs = append(msgs, Message{Sender: RoleAgent, Text: obs.Reply})
+	}
+
+	return msgs, nil
+}
@@ -0,0 +1,257 @@
+package clichat
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// BusEvent is something that happened in a conversation, published on a
+// Bus.
+type BusEvent interface {
+	session() string
+	turn() int
+}
+
+type (
+	// CustomerSaid is a customer message, with the conversation so far,
+	// that the agent should answer.
+	CustomerSaid struct {
+		MessageContext
+	}
+
+	// AgentSaid is a reply the customer can see, written by the model or
+	// the operator.
+	AgentSaid struct {
+		SessionID string
+		Turn      int
+		Message   Message
+	}
+
+	// ActionRequested is a tool the model chose to run.
+	ActionRequested struct {
+		SessionID string
+		Turn      int
+		Action    Message
+	}
+
+	// ObservationReady is what the Backend reported back to the model.
+	ObservationReady struct {
+		SessionID   string
+		Turn        int
+		Observation Message
+	}
+
+	// ThoughtEmitted is the model's reasoning for its next step.
+	ThoughtEmitted struct {
+		SessionID string
+		Turn      int
+		Thought   Message
+	}
+
+	// DraftResolved is what the operator did with a copilot draft.
+	DraftResolved struct {
+		SessionID string
+		Turn      int
+		Draft     Message
+	}
+)
+
+func (e CustomerSaid) session() string     { return e.SessionID }
+func (e AgentSaid) session() string        { return e.SessionID }
+func (e ActionRequested) session() string  { return e.SessionID }
+func (e ObservationReady) session() string { return e.SessionID }
+func (e ThoughtEmitted) session() string   { return e.SessionID }
+func (e DraftResolved) session() string    { return e.SessionID }
+
+func (e CustomerSaid) turn() int     { return e.Turn }
+func (e AgentSaid) turn() int        { return e.Turn }
+func (e ActionRequested) turn() int  { return e.Turn }
+func (e ObservationReady) turn() int { return e.Turn }
+func (e ThoughtEmitted) turn() int   { return e.Turn }
+func (e DraftResolved) turn() int    { return e.Turn }
+
+// messageEvent is the event published when msg joins a conversation, or nil
+// for messages no one subscribes to. history is the conversation including
+// msg; prompt only matters for customer messages.
+func messageEvent(sessionID string, msg Message, history []Message, prompt string) BusEvent {
+	turn := customerTurns(history)
+	switch msg.Sender {
+	case RoleCustomer:
+		return CustomerSaid{MessageContext{
+			SessionID: sessionID,
+			Turn:      turn,
+			Current:   msg,
+			History:   append([]Message{}, history...),
+			Prompt:    prompt,
+		}}
+	case RoleAgent:
+		return AgentSaid{SessionID: sessionID, Turn: turn, Message: msg}
+	case RoleAction:
+		return ActionRequested{SessionID: sessionID, Turn: turn, Action: msg}
+	case RoleObservation:
+		return ObservationReady{SessionID: sessionID, Turn: turn, Observation: msg}
+	case RoleThought:
+		return ThoughtEmitted{SessionID: sessionID, Turn: turn, Thought: msg}
+	case RoleDraft:
+		return DraftResolved{SessionID: sessionID, Turn: turn, Draft: msg}
+	}
+	return nil
+}
+
+// Bus delivers events to every subscriber through its own bounded queue.
+// Publish never blocks: when a subscriber's queue is full the event is
+// dropped for that subscriber and counted. A nil *Bus discards everything.
+type Bus struct {
+	mu     sync.RWMutex
+	subs   []*Subscription
+	closed bool
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscription is one subscriber's queue.
+type Subscription struct {
+	name   string
+	queue  chan BusEvent
+	accept func(BusEvent) bool
+
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+	highWater atomic.Int64
+}
+
+// SubscriberMetrics shows how far behind a subscriber is.
+type SubscriberMetrics struct {
+	Name      string
+	Queued    int
+	Capacity  int
+	HighWater int
+	Delivered uint64
+	Dropped   uint64
+}
+
+// Subscribe adds a subscriber with a queue of size events. Only events
+// accept returns true for are queued; a nil accept takes everything.
+func (b *Bus) Subscribe(name string, size int, accept func(BusEvent) bool) *Subscription {
+	sub := &Subscription{
+		name:   name,
+		queue:  make(chan BusEvent, size),
+		accept: accept,
+	}
+	if b == nil {
+		return sub
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(sub.queue)
+	}
+	b.subs = append(b.subs, sub)
+	return sub
+}
+
+// Events is closed when the Bus is closed.
+func (s *Subscription) Events() <-chan BusEvent {
+	return s.queue
+}
+
+func (b *Bus) Publish(e BusEvent) {
+	if b == nil || e == nil {
+		return
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+
+	for _, sub := range b.subs {
+		if sub.accept != nil && !sub.accept(e) {
+			continue
+		}
+
+		select {
+		case sub.queue <- e:
+			sub.delivered.Add(1)
+			sub.recordDepth(int64(len(sub.queue)))
+		default:
+			// Only the first drop is logged so a stuck subscriber
+			// cannot flood the log.
+			if sub.dropped.Add(1) == 1 {
+				log.Printf("Bus dropped %T for slow subscriber %s", e, sub.name)
+			}
+		}
+	}
+}
+
+func (s *Subscription) recordDepth(depth int64) {
+	for {
+		high := s.highWater.Load()
+		if depth <= high || s.highWater.CompareAndSwap(high, depth) {
+			return
+		}
+	}
+}
+
+func (m SubscriberMetrics) String() string {
+	return fmt.Sprintf("%s: %d/%d queued, high water %d, %d delivered, %d dropped", m.Name, m.Queued, m.Capacity, m.HighWater, m.Delivered, m.Dropped)
+}
+
+func (b *Bus) Metrics() []SubscriberMetrics {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	metrics := []SubscriberMetrics{}
+	for _, sub := range b.subs {
+		metrics = append(metrics, SubscriberMetrics{
+			Name:      sub.name,
+			Queued:    len(sub.queue),
+			Capacity:  cap(sub.queue),
+			HighWater: int(sub.highWater.Load()),
+			Delivered: sub.delivered.Load(),
+			Dropped:   sub.dropped.Load(),
+		})
+	}
+	return metrics
+}
+
+// Close ends every subscription once its queued events are read.
+func (b *Bus) Close() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for _, sub := range b.subs {
+		close(sub.queue)
+	}
+}
+
+// Only returns an accept func for Subscribe that takes events of the same
+// types as examples, e.g. Only(CustomerSaid{}).
+func Only(examples ...BusEvent) func(BusEvent) bool {
+	return func(e BusEvent) bool {
+		for _, example := range examples {
+			if reflect.TypeOf(e) == reflect.TypeOf(example) {
+				return true
+			}
+		}
+		return false
+	}
+}
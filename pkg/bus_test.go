@@ -0,0 +1,90 @@
+package clichat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBusDropsWhenFull(t *testing.T) {
+	bus := NewBus()
+	defer bus.Close()
+	sub := bus.Subscribe("slow", 1, nil)
+
+	published := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			bus.Publish(AgentSaid{SessionID: "s"})
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a full queue")
+	}
+
+	metrics := bus.Metrics()
+	if len(metrics) != 1 {
+		t.Fatalf("got metrics for %d subscribers, want 1", len(metrics))
+	}
+	if m := metrics[0]; m.Delivered != 1 || m.Dropped != 2 || m.Queued != 1 || m.HighWater != 1 {
+		t.Errorf("metrics are %s, want 1 delivered, 2 dropped", m)
+	}
+	if e := <-sub.Events(); e != (AgentSaid{SessionID: "s"}) {
+		t.Errorf("queued event is %#v", e)
+	}
+}
+
+func TestBusOnly(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe("agent", 10, Only(AgentSaid{}, DraftResolved{}))
+
+	bus.Publish(CustomerSaid{MessageContext{SessionID: "s"}})
+	bus.Publish(AgentSaid{SessionID: "s", Turn: 1})
+	bus.Publish(ThoughtEmitted{SessionID: "s"})
+	bus.Publish(DraftResolved{SessionID: "s", Turn: 1})
+	bus.Close()
+
+	want := []BusEvent{AgentSaid{SessionID: "s", Turn: 1}, DraftResolved{SessionID: "s", Turn: 1}}
+	got := []BusEvent{}
+	for e := range sub.Events() {
+		got = append(got, e)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d is %#v, want %#v", i, got[i], want[i])
+		}
+	}
+}
+
+// Close must hand out what is already queued before ending a subscription,
+// and a subscription added afterwards is ended straight away.
+func TestBusClose(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe("late reader", 10, nil)
+	bus.Publish(AgentSaid{SessionID: "a"})
+	bus.Publish(AgentSaid{SessionID: "b"})
+	bus.Close()
+	bus.Publish(AgentSaid{SessionID: "c"})
+
+	sessions := ""
+	for e := range sub.Events() {
+		sessions += e.session()
+	}
+	if sessions != "ab" {
+		t.Errorf("drained events of sessions %q, want %q", sessions, "ab")
+	}
+
+	late := bus.Subscribe("after close", 10, nil)
+	select {
+	case e, ok := <-late.Events():
+		if ok {
+			t.Errorf("subscription after Close got %#v", e)
+		}
+	case <-time.After(time.Second):
+		t.Error("subscription after Close is still open")
+	}
+}
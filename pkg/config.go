@@ -0,0 +1,289 @@
+package clichat
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is everything that can be set from the config file. Fields with an
+// env tag can also be overridden by that environment variable, and the
+// command line flags override both.
+type Config struct {
+	Provider ProviderConfig `yaml:"provider"`
+	Agent    AgentConfig    `yaml:"agent"`
+	// Tools sets the policy of individual tools. Use forbidden to disable
+	// a tool.
+	Tools  map[string]ToolPolicy `yaml:"tools"`
+	Orders string                `yaml:"orders" env:"CLICHAT_ORDERS"`
+	Serve  string                `yaml:"serve" env:"CLICHAT_SERVE"`
+	UI     UIOptions             `yaml:"ui"`
+	Logs   LogConfig             `yaml:"logs"`
+}
+
+type AgentConfig struct {
+	// Prompt defaults to the builtin prompt of the ResponseFormat, and
+	// must be a template written for that format.
+	Prompt          string         `yaml:"prompt" env:"CLICHAT_PROMPT"`
+	ResponseFormat  ResponseFormat `yaml:"response_format" env:"CLICHAT_RESPONSE_FORMAT"`
+	MinConfidence   float64        `yaml:"min_confidence" env:"CLICHAT_MIN_CONFIDENCE"`
+	PromptDir       string         `yaml:"prompt_dir" env:"CLICHAT_PROMPT_DIR"`
+	ToolProtocol    ToolProtocol   `yaml:"tool_protocol" env:"CLICHAT_TOOL_PROTOCOL"`
+	MaxSteps        int            `yaml:"max_steps" env:"CLICHAT_MAX_STEPS"`
+	Timeout         time.Duration  `yaml:"timeout" env:"CLICHAT_AGENT_TIMEOUT"`
+	CallTimeout     time.Duration  `yaml:"call_timeout" env:"CLICHAT_CALL_TIMEOUT"`
+	ApprovalTimeout time.Duration  `yaml:"approval_timeout" env:"CLICHAT_APPROVAL_TIMEOUT"`
+	Retries         int            `yaml:"retries" env:"CLICHAT_RETRIES"`
+	ContextWindow   int            `yaml:"context_window" env:"CLICHAT_CONTEXT_WINDOW"`
+	Copilot         bool           `yaml:"copilot" env:"CLICHAT_COPILOT"`
+	Drafts          int            `yaml:"drafts" env:"CLICHAT_DRAFTS"`
+	SessionBudget   float64        `yaml:"session_budget" env:"CLICHAT_SESSION_BUDGET"`
+}
+
+type LogConfig struct {
+	SessionDir string `yaml:"session_dir" env:"CLICHAT_SESSION_DIR"`
+	EventLog   string `yaml:"event_log" env:"CLICHAT_EVENT_LOG"`
+	UsageLog   string `yaml:"usage_log" env:"CLICHAT_USAGE_LOG"`
+	Prices     string `yaml:"prices" env:"CLICHAT_PRICES"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Provider: ProviderConfig{
+			Name:        "openai",
+			Model:       openai.GPT4,
+			Temperature: 0.3,
+		},
+		Agent: AgentConfig{
+			ResponseFormat:  FormatReAct,
+			PromptDir:       "prompts",
+			ToolProtocol:    ProtocolReAct,
+			MaxSteps:        DefaultMaxSteps,
+			Timeout:         DefaultTimeout,
+			CallTimeout:     DefaultCallTimeout,
+			ApprovalTimeout: DefaultApprovalTimeout,
+			Retries:         DefaultRetries,
+			Drafts:          1,
+		},
+		Tools: map[string]ToolPolicy{},
+		UI:    DefaultUIOptions(),
+		Logs: LogConfig{
+			SessionDir: "sessions",
+			EventLog:   "events.jsonl",
+			UsageLog:   "usage.jsonl",
+		},
+	}
+}
+
+// LoadConfig reads a YAML config file on top of DefaultConfig. Unknown keys
+// are an error so typos don't go unnoticed.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return cfg, err
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("reading %s: %w", path, err)
+	}
+	// An empty tools: key decodes to a nil map.
+	if cfg.Tools == nil {
+		cfg.Tools = map[string]ToolPolicy{}
+	}
+
+	return cfg, nil
+}
+
+// ApplyEnv overrides every field that has an env tag with the value of that
+// environment variable, if it is set.
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	return applyEnv(reflect.ValueOf(c).Elem(), lookup)
+}
+
+func applyEnv(v reflect.Value, lookup func(string) (string, bool)) error {
+	for i := 0; i < v.NumField(); i++ {
+		field, kind := v.Field(i), v.Type().Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := kind.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+
+		if err := setField(field, value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, value string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		field.SetInt(int64(n))
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	errs := []error{}
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	switch c.Provider.Name {
+	case "openai":
+		if c.Provider.APIKey == "" {
+			fail("provider.api_key: required for the openai provider (or set OPENAI_API_KEY)")
+		}
+	case "http":
+		if c.Provider.BaseURL == "" {
+			fail("provider.base_url: required for the http provider")
+		}
+	case "scripted":
+		if c.Provider.ScriptPath == "" {
+			fail("provider.script: required for the scripted provider")
+		}
+	default:
+		fail("provider.name: unknown provider %q, want openai, http or scripted", c.Provider.Name)
+	}
+	if c.Provider.Temperature < 0 || c.Provider.Temperature > 2 {
+		fail("provider.temperature: %g is outside 0-2", c.Provider.Temperature)
+	}
+
+	if c.Agent.ResponseFormat != FormatReAct && c.Agent.ResponseFormat != FormatJSON {
+		fail("agent.response_format: unknown format %q, want react or json", c.Agent.ResponseFormat)
+	}
+	if c.Agent.MinConfidence < 0 || c.Agent.MinConfidence > 1 {
+		fail("agent.min_confidence: %g is outside 0-1", c.Agent.MinConfidence)
+	}
+	if c.Agent.ToolProtocol != ProtocolReAct && c.Agent.ToolProtocol != ProtocolFunctions {
+		fail("agent.tool_protocol: unknown protocol %q, want react or functions", c.Agent.ToolProtocol)
+	}
+	if c.Agent.MaxSteps < 1 {
+		fail("agent.max_steps: must be at least 1")
+	}
+	if c.Agent.Timeout <= 0 {
+		fail("agent.timeout: must be positive")
+	}
+	if c.Agent.CallTimeout <= 0 {
+		fail("agent.call_timeout: must be positive")
+	}
+	if c.Agent.ApprovalTimeout <= 0 {
+		fail("agent.approval_timeout: must be positive")
+	}
+	if c.Agent.Retries < 0 {
+		fail("agent.retries: must not be negative")
+	}
+	if c.Agent.ContextWindow < 0 {
+		fail("agent.context_window: must not be negative")
+	}
+	if c.Agent.Drafts < 1 {
+		fail("agent.drafts: must be at least 1")
+	}
+	if c.Agent.SessionBudget < 0 {
+		fail("agent.session_budget: must not be negative")
+	}
+
+	for name, policy := range c.Tools {
+		switch policy {
+		case PolicyAuto, PolicyApprove, PolicyForbidden:
+		default:
+			fail("tools.%s: unknown policy %q, want auto, approve or forbidden", name, policy)
+		}
+	}
+
+	if minWidth := SIDEBAR_WIDTH + 2*minPaneWidth; c.UI.Width < minWidth {
+		fail("ui.width: must be at least %d", minWidth)
+	}
+	if c.UI.Height < 10 {
+		fail("ui.height: must be at least 10")
+	}
+	if c.UI.CharLimit < 1 {
+		fail("ui.char_limit: must be at least 1")
+	}
+
+	if c.Logs.SessionDir == "" {
+		fail("logs.session_dir: required")
+	}
+
+	return errors.Join(errs...)
+}
+
+// Options returns the AIClientOptions for the agent settings. Tools, the
+// ledger, the event log and the fallback provider are left for the caller
+// to fill in.
+func (c AgentConfig) Options() AIClientOptions {
+	prompt := c.Prompt
+	if prompt == "" {
+		prompt = c.ResponseFormat.Prompt()
+	}
+
+	return AIClientOptions{
+		Prompt:          prompt,
+		MinConfidence:   c.MinConfidence,
+		Protocol:        c.ToolProtocol,
+		MaxSteps:        c.MaxSteps,
+		Timeout:         c.Timeout,
+		CallTimeout:     c.CallTimeout,
+		ApprovalTimeout: c.ApprovalTimeout,
+		Retries:         c.Retries,
+		ContextWindow:   c.ContextWindow,
+		Copilot:         c.Copilot,
+		Drafts:          c.Drafts,
+		SessionBudget:   c.SessionBudget,
+	}
+}
@@ -0,0 +1,33 @@
+package clichat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "clichat.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// An empty tools: key must not leave a nil map that -policy then writes to.
+func TestLoadConfigEmptyTools(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, "provider:\ntools:\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Tools == nil {
+		t.Fatal("Tools is nil")
+	}
+
+	cfg.Tools["ReturnOrderFlow"] = PolicyAuto
+	cfg.Provider.APIKey = "test"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+}
@@ -2,4 +2,7 @@ package clichat
 
 const HEIGHT = 40
 const WIDTH = 120
-const VIEW_WIDTH = WIDTH / 2
+const SIDEBAR_WIDTH = 24
+
+// minPaneWidth is the narrowest each conversation pane may be.
+const minPaneWidth = 30
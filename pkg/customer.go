@@ -0,0 +1,146 @@
+package clichat
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+var demoCustomers = []user{me}
+
+type conversationKey struct{}
+
+// Conversation is per-conversation state that tools can read and update
+// between steps, such as the customer identified so far.
+type Conversation struct {
+	mu       sync.Mutex
+	customer *user
+
+	// summary covers the first summarized messages of the history.
+	summary    string
+	summarized int
+}
+
+func (c *Conversation) Customer() *user {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.customer
+}
+
+func (c *Conversation) SetCustomer(u *user) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.customer = u
+}
+
+// customerTurns counts the customer messages in history, which numbers the
+// turn started by the last of them.
+func customerTurns(history []Message) int {
+	turns := 0
+	for _, msg := range history {
+		if msg.Sender == RoleCustomer {
+			turns++
+		}
+	}
+	return turns
+}
+
+// restoreConversation rebuilds the state of a conversation resumed with
+// history, such as the customer identified earlier.
+func restoreConversation(history []Message) *Conversation {
+	c := &Conversation{}
+	for _, msg := range history {
+		if msg.Sender == RoleIdentified && msg.Customer != nil {
+			c.customer = msg.Customer
+		}
+	}
+	return c
+}
+
+// Summary returns the cached summary of the first n messages, if any. It is
+// safe to call on a nil Conversation.
+func (c *Conversation) Summary(n int) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.summary, c.summarized == n && c.summary != ""
+}
+
+func (c *Conversation) SetSummary(n int, summary string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.summary, c.summarized = summary, n
+}
+
+func WithConversation(ctx context.Context, c *Conversation) context.Context {
+	return context.WithValue(ctx, conversationKey{}, c)
+}
+
+// ConversationFrom returns the conversation attached to ctx or nil.
+func ConversationFrom(ctx context.Context) *Conversation {
+	c, _ := ctx.Value(conversationKey{}).(*Conversation)
+	return c
+}
+
+// looksLikePhone reports whether input is made up only of digits and phone
+// punctuation with at least seven digits.
+func looksLikePhone(input string) bool {
+	if strings.Trim(input, "0123456789+-(). ") != "" {
+		return false
+	}
+	return len(normalizePhone(input)) >= 7
+}
+
+// findCustomer matches input against email, phone number or full name.
+func findCustomer(customers []user, input string) *user {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil
+	}
+
+	for i, u := range customers {
+		switch {
+		case strings.Contains(input, "@"):
+			if strings.EqualFold(u.Email, input) {
+				return &customers[i]
+			}
+		case looksLikePhone(input):
+			if normalizePhone(u.Phone) == normalizePhone(input) {
+				return &customers[i]
+			}
+		default:
+			if strings.EqualFold(u.FirstName+" "+u.LastName, strings.Join(strings.Fields(input), " ")) {
+				return &customers[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+func customerLookup(customers []user) ToolHandler {
+	return func(ctx context.Context, input string) (Observation, error) {
+		result := userResult{LookupUserBy: input}
+
+		if u := findCustomer(customers, input); u != nil {
+			found := *u
+			result.User = &found
+			if c := ConversationFrom(ctx); c != nil {
+				c.SetCustomer(&found)
+			}
+		}
+
+		userJson, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return Observation{}, err
+		}
+
+		return Observation{Text: string(userJson), Customer: result.User}, nil
+	}
+}
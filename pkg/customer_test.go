@@ -0,0 +1,45 @@
+package clichat
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// The customer found by CustomerLookup must survive a resume so OrderSearch
+// can still be called without input.
+func TestResumeKeepsCustomer(t *testing.T) {
+	store, err := NewSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := store.Create()
+	backend := NewBackend(DefaultTools(NewMemoryOrderStore(demoOrders)))
+
+	ctx := WithConversation(context.Background(), &Conversation{})
+	msgs, err := backend.Chat(ctx, Message{Sender: RoleAction, Text: "CustomerLookup", Input: me.Email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Append(msgs...); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed, err := store.Open(session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conversation := restoreConversation(resumed.Messages)
+	if u := conversation.Customer(); u == nil || *u != me {
+		t.Fatalf("restored customer is %+v, want %+v", u, me)
+	}
+
+	ctx = WithConversation(context.Background(), conversation)
+	msgs, err = backend.Chat(ctx, Message{Sender: RoleAction, Text: "OrderSearch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) == 0 || !strings.Contains(msgs[0].Text, `"lookup_orders_by_email"`) {
+		t.Errorf("OrderSearch without input returned %+v, want the customer's orders", msgs)
+	}
+}
@@ -0,0 +1,169 @@
+package clichat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const escalationAction = "EscalateToHuman"
+
+type (
+	// EvalCase is a single agent behaviour check. Given History the model's
+	// next response must satisfy every expectation that is set.
+	EvalCase struct {
+		Name    string    `json:"name"`
+		History []Message `json:"history"`
+
+		ExpectAction     string   `json:"expect_action,omitempty"`
+		ExpectInput      string   `json:"expect_input,omitempty"`
+		ExpectEscalation *bool    `json:"expect_escalation,omitempty"`
+		Forbidden        []string `json:"forbidden,omitempty"`
+	}
+
+	EvalResult struct {
+		Name        string        `json:"name"`
+		Passed      bool          `json:"passed"`
+		Failures    []string      `json:"failures,omitempty"`
+		Action      string        `json:"action,omitempty"`
+		ActionInput string        `json:"action_input,omitempty"`
+		Agent       string        `json:"agent,omitempty"`
+		Error       string        `json:"error,omitempty"`
+		Latency     time.Duration `json:"latency_ns"`
+	}
+
+	EvalReport struct {
+		Total   int          `json:"total"`
+		Passed  int          `json:"passed"`
+		Results []EvalResult `json:"results"`
+	}
+)
+
+func LoadEvalCases(path string) ([]EvalCase, error) {
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cases []EvalCase
+	if err := json.Unmarshal(bts, &cases); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	for _, c := range cases {
+		if c.ExpectInput == "" {
+			continue
+		}
+		if _, err := regexp.Compile(c.ExpectInput); err != nil {
+			return nil, fmt.Errorf("case %s: %w", c.Name, err)
+		}
+	}
+
+	return cases, nil
+}
+
+// Evaluator asks the model for its next step on each case using the same
+// prompt and parser as the live agent.
+type Evaluator struct {
+	ai *AIClient
+}
+
+func NewEvaluator(provider Provider, opts AIClientOptions) *Evaluator {
+	return &Evaluator{ai: NewAIClient(nil, provider, nil, opts, nil)}
+}
+
+func (e *Evaluator) Run(ctx context.Context, cases []EvalCase) EvalReport {
+	report := EvalReport{Results: []EvalResult{}}
+
+	for _, c := range cases {
+		result := e.runCase(ctx, c)
+		report.Total++
+		if result.Passed {
+			report.Passed++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	return report
+}
+
+func (e *Evaluator) runCase(ctx context.Context, c EvalCase) EvalResult {
+	result := EvalResult{Name: c.Name}
+
+	ctx, cancel := context.WithTimeout(ctx, e.ai.opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := e.ai.provider.Complete(ctx, e.ai.request(e.ai.opts.Prompt, c.History))
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Error = err.Error()
+		result.Failures = []string{"completion failed"}
+		return result
+	}
+
+	next := e.ai.parse(e.ai.opts.Prompt, resp)
+	result.Action = next.Action
+	result.ActionInput = next.ActionInput
+	result.Agent = next.Agent
+	result.Failures = checkEvalCase(c, next)
+	result.Passed = len(result.Failures) == 0
+
+	return result
+}
+
+func checkEvalCase(c EvalCase, next AiResponse) []string {
+	failures := []string{}
+
+	if c.ExpectAction != "" && next.Action != c.ExpectAction {
+		failures = append(failures, fmt.Sprintf("expected action %q, got %q", c.ExpectAction, next.Action))
+	}
+
+	if c.ExpectInput != "" {
+		re := regexp.MustCompile(c.ExpectInput)
+		if !re.MatchString(next.ActionInput) {
+			failures = append(failures, fmt.Sprintf("action input %q does not match %q", next.ActionInput, c.ExpectInput))
+		}
+	}
+
+	if c.ExpectEscalation != nil {
+		escalated := next.Action == escalationAction
+		if escalated != *c.ExpectEscalation {
+			failures = append(failures, fmt.Sprintf("expected escalation %t, got %t", *c.ExpectEscalation, escalated))
+		}
+	}
+
+	agent := strings.ToLower(next.Agent)
+	for _, phrase := range c.Forbidden {
+		if strings.Contains(agent, strings.ToLower(phrase)) {
+			failures = append(failures, fmt.Sprintf("agent said forbidden phrase %q", phrase))
+		}
+	}
+
+	return failures
+}
+
+// WriteScorecard prints a human readable pass/fail summary.
+func (r EvalReport) WriteScorecard(w io.Writer) {
+	for _, result := range r.Results {
+		if result.Passed {
+			fmt.Fprintf(w, "PASS  %s (%s)\n", result.Name, result.Latency.Round(time.Millisecond))
+			continue
+		}
+
+		fmt.Fprintf(w, "FAIL  %s (%s)\n", result.Name, result.Latency.Round(time.Millisecond))
+		if result.Error != "" {
+			fmt.Fprintf(w, "      error: %s\n", result.Error)
+		}
+		for _, failure := range result.Failures {
+			fmt.Fprintf(w, "      %s\n", failure)
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d/%d passed\n", r.Passed, r.Total)
+}
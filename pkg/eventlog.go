@@ -0,0 +1,246 @@
+package clichat
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType is the kind of thing an Event records.
+type EventType string
+
+const (
+	EventPrompt      EventType = "prompt"
+	EventCompletion  EventType = "completion"
+	EventAction      EventType = "action"
+	EventObservation EventType = "observation"
+	EventThought     EventType = "thought"
+	EventMessage     EventType = "message"
+	EventStopped     EventType = "stopped"
+	EventError       EventType = "error"
+	// EventLogLine is a line written through the standard log package.
+	EventLogLine EventType = "log"
+)
+
+// Event is one line of the event log. SessionID and Turn tie it to the
+// customer message that caused it.
+type Event struct {
+	Time       time.Time     `json:"time"`
+	SessionID  string        `json:"session_id,omitempty"`
+	Turn       int           `json:"turn,omitempty"`
+	Type       EventType     `json:"type"`
+	Sender     string        `json:"sender,omitempty"`
+	Text       string        `json:"text,omitempty"`
+	Input      string        `json:"input,omitempty"`
+	Prompt     string        `json:"prompt,omitempty"`  // template of a prompt event
+	Outcome    DraftOutcome  `json:"outcome,omitempty"` // what became of a copilot draft
+	Latency    time.Duration `json:"latency_ns,omitempty"`
+	Usage      *Usage        `json:"usage,omitempty"`
+	Steps      int           `json:"steps,omitempty"`
+	Confidence *float64      `json:"confidence,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+type turnKey struct{}
+
+type turnInfo struct {
+	SessionID string
+	Turn      int
+}
+
+// WithTurn tags ctx with the session and turn that events recorded with it
+// belong to.
+func WithTurn(ctx context.Context, sessionID string, turn int) context.Context {
+	return context.WithValue(ctx, turnKey{}, turnInfo{SessionID: sessionID, Turn: turn})
+}
+
+// EventLog appends Events to a JSONL file. A nil *EventLog discards
+// everything, so callers don't need to check whether logging is enabled.
+type EventLog struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+
+	// following is done once the bus given to Follow is closed and its
+	// queued messages are recorded.
+	following sync.WaitGroup
+}
+
+func NewEventLog(w io.Writer) *EventLog {
+	return &EventLog{w: w, enc: json.NewEncoder(w)}
+}
+
+func OpenEventLog(path string) (*EventLog, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return NewEventLog(f), nil
+}
+
+// Record writes e, filling in the time and, from ctx, the session and turn.
+func (l *EventLog) Record(ctx context.Context, e Event) {
+	if l == nil {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if t, ok := ctx.Value(turnKey{}).(turnInfo); ok {
+		if e.SessionID == "" {
+			e.SessionID = t.SessionID
+		}
+		if e.Turn == 0 {
+			e.Turn = t.Turn
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enc.Encode(e)
+}
+
+// Follow records the messages, actions, observations and thoughts published
+// on bus. Prompts, completions and errors are recorded by the AIClient and
+// Backend as they happen.
+func (l *EventLog) Follow(bus *Bus) {
+	if l == nil {
+		return
+	}
+
+	sub := bus.Subscribe("event log", 1000, Only(CustomerSaid{}, AgentSaid{}, DraftResolved{}, ActionRequested{}, ObservationReady{}, ThoughtEmitted{}))
+	l.following.Add(1)
+	go func() {
+		defer l.following.Done()
+		for e := range sub.Events() {
+			event := Event{SessionID: e.session(), Turn: e.turn()}
+			switch e := e.(type) {
+			case CustomerSaid:
+				event.Type, event.Sender, event.Text = EventMessage, string(e.Current.Sender), e.Current.Text
+			case AgentSaid:
+				event.Type, event.Sender, event.Text = EventMessage, string(e.Message.Sender), e.Message.Text
+			case DraftResolved:
+				event.Type, event.Sender, event.Text = EventMessage, string(e.Draft.Sender), e.Draft.Text
+				event.Outcome = e.Draft.Outcome
+			case ActionRequested:
+				event.Type, event.Text, event.Input = EventAction, e.Action.Text, e.Action.Input
+			case ObservationReady:
+				event.Type, event.Text = EventObservation, e.Observation.Text
+			case ThoughtEmitted:
+				event.Type, event.Text = EventThought, e.Thought.Text
+			}
+			l.Record(context.Background(), event)
+		}
+	}()
+}
+
+// Write lets the EventLog stand in for the standard logger's output.
+func (l *EventLog) Write(p []byte) (int, error) {
+	l.Record(context.Background(), Event{Type: EventLogLine, Text: strings.TrimRight(string(p), "\n")})
+	return len(p), nil
+}
+
+// Close waits for Follow to finish, so close the bus first.
+func (l *EventLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.following.Wait()
+	if c, ok := l.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// EventFilter selects events from a log. Zero fields match everything.
+type EventFilter struct {
+	SessionID string
+	Turn      int
+	Types     []EventType
+}
+
+func (f EventFilter) Match(e Event) bool {
+	if f.SessionID != "" && e.SessionID != f.SessionID {
+		return false
+	}
+	if f.Turn != 0 && e.Turn != f.Turn {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if e.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadEvents returns the events in r that match filter. Lines that are not
+// valid events are skipped.
+func ReadEvents(r io.Reader, filter EventFilter) ([]Event, error) {
+	events := []Event{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if filter.Match(e) {
+			events = append(events, e)
+		}
+	}
+	return events, scanner.Err()
+}
+
+// FormatEvent renders e as a single human readable line.
+func FormatEvent(e Event) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "%s ", e.Time.Format("2006-01-02 15:04:05.000"))
+	if e.SessionID != "" || e.Turn != 0 {
+		fmt.Fprintf(&sb, "%s#%d ", e.SessionID, e.Turn)
+	}
+	fmt.Fprintf(&sb, "%-11s ", e.Type)
+
+	if e.Sender != "" {
+		fmt.Fprintf(&sb, "%s: ", e.Sender)
+	}
+	sb.WriteString(strings.ReplaceAll(e.Text, "\n", `\n`))
+	if e.Input != "" {
+		fmt.Fprintf(&sb, " [%s]", e.Input)
+	}
+	if e.Prompt != "" {
+		fmt.Fprintf(&sb, " prompt=%s", e.Prompt)
+	}
+	if e.Outcome != "" {
+		fmt.Fprintf(&sb, " (%s)", e.Outcome)
+	}
+	if e.Confidence != nil {
+		fmt.Fprintf(&sb, " confidence=%.2f", *e.Confidence)
+	}
+	if e.Steps > 0 {
+		fmt.Fprintf(&sb, " after %d steps", e.Steps)
+	}
+	if e.Error != "" {
+		fmt.Fprintf(&sb, " error=%q", e.Error)
+	}
+	if e.Latency > 0 {
+		fmt.Fprintf(&sb, " (%s", e.Latency.Round(time.Millisecond))
+		if e.Usage != nil {
+			fmt.Fprintf(&sb, ", %d tokens", e.Usage.TotalTokens)
+		}
+		sb.WriteString(")")
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,81 @@
+package clichat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+// A resumed session must keep numbering its turns, and what Follow records
+// from the bus must carry the turn of the run that produced it, once.
+func TestEventLogTurns(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewEventLog(&buf)
+	bus := NewBus()
+	log.Follow(bus)
+
+	history := []Message{
+		{Sender: RoleCustomer, Text: "Hi"},
+		{Sender: RoleAgent, Text: "Hello, how can I help?"},
+		{Sender: RoleCustomer, Text: "Where is my order?"},
+		{Sender: RoleAgent, Text: "Which order?"},
+	}
+	customer := Message{Sender: RoleCustomer, Text: "123456"}
+	history = append(history, customer)
+	bus.Publish(messageEvent("s", customer, history, ""))
+
+	program := &recordingSender{}
+	provider := NewScriptedProvider(
+		"Thought: I should look it up\nAction: OrderLookup\nAction Input: 123456",
+		"Agent: It ships tomorrow.",
+	)
+	backend := NewBackend(DefaultTools(NewMemoryOrderStore(demoOrders)))
+	ai := NewAIClient(program, provider, backend, AIClientOptions{Events: log}, nil)
+	ai.Chat(context.Background(), restoreConversation(history), MessageContext{SessionID: "s", Current: customer, History: history})
+
+	for _, msg := range program.sent() {
+		var msgs Messages
+		switch msg := msg.(sessionMsg).Msg.(type) {
+		case Message:
+			msgs = Messages{msg}
+		case Messages:
+			msgs = msg
+		}
+		for _, msg := range msgs {
+			history = append(history, msg)
+			bus.Publish(messageEvent("s", msg, history, ""))
+		}
+	}
+	bus.Close()
+	log.Close()
+
+	recorded := map[EventType]int{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e Event
+		if err := dec.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Type == EventLogLine {
+			continue
+		}
+		recorded[e.Type]++
+		if e.SessionID != "s" || e.Turn != 3 {
+			t.Errorf("%s event %q is session %q turn %d, want s turn 3", e.Type, e.Text, e.SessionID, e.Turn)
+		}
+	}
+	for _, want := range []struct {
+		Type  EventType
+		Count int
+	}{
+		{EventMessage, 2},
+		{EventThought, 1},
+		{EventAction, 1},
+		{EventObservation, 1},
+	} {
+		if recorded[want.Type] != want.Count {
+			t.Errorf("recorded %d %s events, want %d", recorded[want.Type], want.Type, want.Count)
+		}
+	}
+}
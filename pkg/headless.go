@@ -0,0 +1,142 @@
+package clichat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Headless stands in for the TUI. It feeds scripted customer turns to the
+// AIClient over the same bus and writes everything that comes back as a
+// plain text transcript.
+type Headless struct {
+	bus *Bus
+	out io.Writer
+
+	mu       sync.Mutex
+	messages []Message
+	err      error
+	stopped  chan agentStoppedMsg
+}
+
+func NewHeadless(bus *Bus, out io.Writer) *Headless {
+	return &Headless{
+		bus:      bus,
+		out:      out,
+		messages: []Message{},
+		stopped:  make(chan agentStoppedMsg, 1),
+	}
+}
+
+// ReadTurns reads one customer message per line. Blank lines and lines
+// starting with # are skipped.
+func ReadTurns(r io.Reader) ([]string, error) {
+	turns := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		turns = append(turns, line)
+	}
+	return turns, scanner.Err()
+}
+
+// Run sends each turn and waits for the agent run it triggers to stop
+// before sending the next one.
+func (h *Headless) Run(turns []string) error {
+	for _, turn := range turns {
+		msg := Message{Sender: RoleCustomer, Text: turn}
+
+		h.mu.Lock()
+		h.record(msg)
+		h.mu.Unlock()
+
+		stopped := <-h.stopped
+
+		h.mu.Lock()
+		fmt.Fprintf(h.out, "-- agent stopped after %d steps: %s\n", stopped.Steps, stopped.Reason)
+		err := h.err
+		h.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Messages returns a copy of the conversation so far.
+func (h *Headless) Messages() []Message {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Message{}, h.messages...)
+}
+
+func (h *Headless) Send(msg tea.Msg) {
+	if sm, ok := msg.(sessionMsg); ok {
+		msg = sm.Msg
+	}
+
+	switch msg := msg.(type) {
+	case agentStoppedMsg:
+		h.stopped <- msg
+	case draftsMsg:
+		// Without an operator the first draft is sent as is.
+		h.mu.Lock()
+		h.record(Message{Sender: RoleAgent, Text: msg.Drafts[0]})
+		h.messages = append(h.messages, stamped(Message{Sender: RoleDraft, Text: msg.Drafts[0], Outcome: DraftAccepted}))
+		h.mu.Unlock()
+	case approvalRequestMsg:
+		// There is no operator in batch mode so every action is approved.
+		h.mu.Lock()
+		fmt.Fprintf(h.out, "-- auto-approved %s\n", msg.Action.Text)
+		h.mu.Unlock()
+		msg.Approve(msg.Action.Input)
+	case Message:
+		h.mu.Lock()
+		h.record(msg)
+		h.mu.Unlock()
+	case Messages:
+		h.mu.Lock()
+		for _, m := range msg {
+			h.record(m)
+		}
+		h.mu.Unlock()
+	case errMsg:
+		h.mu.Lock()
+		fmt.Fprintf(h.out, "Error: %s\n", msg)
+		if h.err == nil {
+			h.err = msg
+		}
+		h.mu.Unlock()
+	}
+}
+
+// record adds msg to the transcript and publishes it on the bus, as the
+// Model does.
+func (h *Headless) record(msg Message) {
+	msg = stamped(msg)
+	h.messages = append(h.messages, msg)
+	fmt.Fprint(h.out, FormatTranscriptLine(msg))
+	h.bus.Publish(messageEvent("", msg, h.messages, ""))
+}
+
+// FormatTranscriptLine renders a message the same way it appears in the
+// prompt history.
+func FormatTranscriptLine(msg Message) string {
+	label := msg.Sender.PromptLabel()
+	switch msg.Sender {
+	case RoleAction:
+		return label + ": " + msg.Text + "\nAction Input: " + msg.Input + "\n"
+	case RoleThought:
+		return label + ": " + strings.TrimRight(msg.Text, "\n") + "\n"
+	}
+	return label + ": " + msg.Text + "\n"
+}
@@ -13,13 +13,92 @@ import (
 	"github.com/muesli/reflow/wordwrap"
 )
 
+// chat is one conversation in the inbox.
+type chat struct {
+	session     *Session
+	messages    []Message
+	streaming   string
+	agentStatus string
+	tokens      tokenBudgetMsg
+	usage       usageMsg
+	confidence  *float64
+	// unavailable is set when the model could not be reached and the
+	// conversation was escalated to a human.
+	unavailable bool
+	// run is the agent run answering the latest customer message, if any.
+	run *agentStartedMsg
+	// prompt is the prompt template chosen with /prompt. Empty means the
+	// default.
+	prompt string
+	unread int
+	// err is the last error of this conversation. It is cleared when the
+	// agent starts answering a new message.
+	err error
+
+	// pending is an action waiting for the operator. While editing is
+	// set the agent textarea holds the action input being edited.
+	pending *approvalRequestMsg
+	editing bool
+
+	// drafts are candidate Agent replies in copilot mode; draftIdx is the
+	// one currently shown in the agent textarea.
+	drafts   []string
+	draftIdx int
+}
+
+func newChat(session *Session) *chat {
+	return &chat{
+		session:  session,
+		messages: append([]Message{}, session.Messages...),
+	}
+}
+
+// add stamps msgs, appends them to the conversation and persists them to
+// the session. It returns the stamped copies; msgs itself may still be in
+// use by the AIClient.
+func (c *chat) add(msgs ...Message) ([]Message, error) {
+	added := []Message{}
+	for _, msg := range msgs {
+		added = append(added, stamped(msg))
+	}
+
+	c.messages = append(c.messages, added...)
+	return added, c.session.Append(added...)
+}
+
+// title is the first thing the customer said, or the session id.
+func (c *chat) title() string {
+	for _, msg := range c.messages {
+		if msg.Sender == RoleCustomer {
+			return msg.Text
+		}
+	}
+	return c.session.ID
+}
+
+// UIOptions sets the size of the TUI and how long a typed message may be.
+type UIOptions struct {
+	Width     int `yaml:"width"`
+	Height    int `yaml:"height"`
+	CharLimit int `yaml:"char_limit"`
+}
+
+func DefaultUIOptions() UIOptions {
+	return UIOptions{Width: WIDTH, Height: HEIGHT, CharLimit: 280}
+}
+
 type Model struct {
 	viewport         viewport.Model
 	internalViewport viewport.Model
 
-	messages    []Message
-	messageChan chan MessageContext
-	backendChan chan MessageContext
+	chats  []*chat
+	active int
+	store  *SessionStore
+	bus    *Bus
+	ui     UIOptions
+
+	prompts       *PromptLibrary
+	defaultPrompt string
 
 	textarea      textarea.Model
 	agentTextarea textarea.Model
@@ -31,17 +110,16 @@ type Model struct {
 	thoughtStyle     lipgloss.Style
 	observationStyle lipgloss.Style
 
-	err error
-	gr  *glamour.TermRenderer
+	gr *glamour.TermRenderer
 }
 
-func InitialModel(messageChan chan MessageContext, backendChan chan MessageContext) Model {
+// InitialModel opens the inbox with one chat per session. The store is used
+// to start new conversations.
+func InitialModel(bus *Bus, store *SessionStore, sessions ...*Session) Model {
 	ta := textarea.New()
 	ta.Placeholder = "Send a user message... [TAB] to switch to agent mode"
 	ta.Focus()
 	ta.Prompt = "┃ "
-	ta.CharLimit = 280
-	ta.SetWidth(VIEW_WIDTH)
 	ta.SetHeight(3)
 	// ta.FocusedStyle.CursorLine = lipgloss.NewStyle()
 	ta.ShowLineNumbers = false
@@ -50,33 +128,23 @@ func InitialModel(messageChan chan MessageContext, backendChan chan MessageConte
 	ata := textarea.New()
 	ata.Placeholder = "Send an agent message... [TAB] to switch to user mode"
 	ata.Prompt = "┃ "
-	ata.CharLimit = 280
-	ata.SetWidth(VIEW_WIDTH)
 	ata.SetHeight(3)
 	// ata.FocusedStyle.CursorLine = lipgloss.NewStyle()
 	ata.ShowLineNumbers = false
 	ata.KeyMap.InsertNewline.SetEnabled(false)
 	ata.Blur()
 
-	vp := viewport.New(VIEW_WIDTH, HEIGHT)
+	vp := viewport.New(0, 0)
 	vp.SetContent(`Type a message as a user to get started.    	      `)
 
-	ivp := viewport.New(VIEW_WIDTH, HEIGHT)
+	ivp := viewport.New(0, 0)
 
-	renderer, err := glamour.NewTermRenderer(
-		glamour.WithAutoStyle(),
-		glamour.WithWordWrap(WIDTH),
-	)
-	if err != nil {
-		panic(err)
-	}
-
-	return Model{
+	m := Model{
 		textarea:         ta,
 		agentTextarea:    ata,
-		messages:         []Message{},
-		messageChan:      messageChan,
-		backendChan:      backendChan,
+		chats:            []*chat{},
+		store:            store,
+		bus:              bus,
 		viewport:         vp,
 		internalViewport: ivp,
 		senderStyle:      lipgloss.NewStyle().Foreground(lipgloss.Color("5")),
@@ -85,9 +153,102 @@ func InitialModel(messageChan chan MessageContext, backendChan chan MessageConte
 		backendStyle:     lipgloss.NewStyle().Foreground(lipgloss.Color("3")),
 		thoughtStyle:     lipgloss.NewStyle().Foreground(lipgloss.Color("4")),
 		observationStyle: lipgloss.NewStyle().Foreground(lipgloss.Color("6")),
-		err:              nil,
-		gr:               renderer,
 	}
+	m = m.WithUI(DefaultUIOptions())
+
+	for _, session := range sessions {
+		m.chats = append(m.chats, newChat(session))
+	}
+	if len(m.chats) == 0 {
+		m.chats = append(m.chats, newChat(store.Create()))
+	}
+
+	if len(m.chat().messages) > 0 {
+		m.refresh()
+	}
+
+	return m
+}
+
+// WithUI resizes the TUI.
+func (m Model) WithUI(ui UIOptions) Model {
+	m.ui = ui
+
+	for _, ta := range []*textarea.Model{&m.textarea, &m.agentTextarea} {
+		ta.CharLimit = ui.CharLimit
+		ta.SetWidth(m.viewWidth())
+	}
+	for _, vp := range []*viewport.Model{&m.viewport, &m.internalViewport} {
+		vp.Width = m.viewWidth()
+		vp.Height = ui.Height
+	}
+
+	renderer, err := glamour.NewTermRenderer(
+		glamour.WithAutoStyle(),
+		glamour.WithWordWrap(m.viewWidth()),
+	)
+	if err != nil {
+		panic(err)
+	}
+	m.gr = renderer
+
+	if len(m.chats) > 0 {
+		m.refresh()
+	}
+	return m
+}
+
+// viewWidth is the width of each of the two conversation panes, which
+// share the width left of the sidebar.
+func (m Model) viewWidth() int {
+	return (m.ui.Width - SIDEBAR_WIDTH) / 2
+}
+
+// WithPrompts lets the operator switch a conversation between the templates
+// in lib with "/prompt <name>".
+func (m Model) WithPrompts(lib *PromptLibrary, defaultPrompt string) Model {
+	m.prompts = lib
+	m.defaultPrompt = defaultPrompt
+	return m
+}
+
+// chat returns the conversation currently on screen.
+func (m Model) chat() *chat {
+	return m.chats[m.active]
+}
+
+func (m Model) chatFor(sessionID string) *chat {
+	for _, c := range m.chats {
+		if c.session.ID == sessionID {
+			return c
+		}
+	}
+	return nil
+}
+
+// refresh redraws both panes from the active chat.
+func (m *Model) refresh() {
+	m.viewport.SetContent(m.messageContent())
+	m.viewport.GotoBottom()
+	m.internalViewport.SetContent(m.internalContent())
+	m.internalViewport.GotoBottom()
+}
+
+// switchTo makes chat idx active and restores its agent textarea state.
+func (m Model) switchTo(idx int) Model {
+	m.active = (idx + len(m.chats)) % len(m.chats)
+
+	c := m.chat()
+	c.unread = 0
+	m.agentTextarea.Reset()
+	if len(c.drafts) > 0 {
+		m.agentTextarea.SetValue(c.drafts[c.draftIdx])
+	} else if c.editing && c.pending != nil {
+		m.agentTextarea.SetValue(c.pending.Action.Input)
+	}
+
+	m.refresh()
+	return m
 }
 
 func (m Model) Init() tea.Cmd {
@@ -95,6 +256,26 @@ func (m Model) Init() tea.Cmd {
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	// Inbox keys, and cancelling a run, are handled before the textareas
+	// see them.
+	if key, ok := msg.(tea.KeyMsg); ok {
+		switch key.String() {
+		case "ctrl+g":
+			if c := m.chat(); c.run != nil {
+				c.run.Cancel()
+				c.agentStatus = "Cancelling..."
+			}
+			return m, nil
+		case "alt+n":
+			m.chats = append(m.chats, newChat(m.store.Create()))
+			return m.switchTo(len(m.chats) - 1), nil
+		case "alt+down", "ctrl+pgdown":
+			return m.switchTo(m.active + 1), nil
+		case "alt+up", "ctrl+pgup":
+			return m.switchTo(m.active - 1), nil
+		}
+	}
+
 	var (
 		tiCmd  tea.Cmd
 		vpCmd  tea.Cmd
@@ -111,13 +292,20 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	// log.Printf("Model.Update: %#v", msg)
 
+	c := m.chat()
+
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch msg.Type {
 		case tea.KeyCtrlC, tea.KeyEsc:
 			fmt.Println(m.textarea.Value())
 			return m, tea.Quit
-		case tea.KeyTab:
+		case tea.KeyTab, tea.KeyShiftTab:
+			if msg.Type == tea.KeyTab && len(c.drafts) > 0 && m.agentTextarea.Focused() {
+				c.draftIdx = (c.draftIdx + 1) % len(c.drafts)
+				m.agentTextarea.SetValue(c.drafts[c.draftIdx])
+				break
+			}
 			if m.textarea.Focused() {
 				m.textarea.Blur()
 				m.agentTextarea.Focus()
@@ -125,116 +313,222 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.agentTextarea.Blur()
 				m.textarea.Focus()
 			}
+		case tea.KeyCtrlY:
+			if c.pending != nil {
+				c.pending.Approve(c.pending.Action.Input)
+				m = m.clearPending(c)
+			}
+		case tea.KeyCtrlR:
+			if c.pending != nil {
+				c.pending.Reject()
+				m = m.clearPending(c)
+			}
+		case tea.KeyCtrlO:
+			if c.pending != nil {
+				c.editing = true
+				m.textarea.Blur()
+				m.agentTextarea.Focus()
+				m.agentTextarea.SetValue(c.pending.Action.Input)
+			}
+		case tea.KeyCtrlX:
+			if len(c.drafts) > 0 {
+				m.addMessages(c, Message{Sender: RoleDraft, Text: c.drafts[c.draftIdx], Outcome: DraftDiscarded})
+				c.drafts = nil
+				m.agentTextarea.Reset()
+				m.refresh()
+			}
 		case tea.KeyEnter:
+			if c.editing && c.pending != nil {
+				c.pending.Approve(m.agentTextarea.Value())
+				m.agentTextarea.Reset()
+				m = m.clearPending(c)
+				break
+			}
+
+			if value := m.focusedTextarea().Value(); strings.HasPrefix(value, "/prompt") {
+				m.focusedTextarea().Reset()
+				m.switchPrompt(c, strings.TrimSpace(strings.TrimPrefix(value, "/prompt")))
+				break
+			}
+
 			var outMsg Message
 
 			if m.textarea.Focused() {
 				outMsg = Message{
-					Sender: "You",
+					Sender: RoleCustomer,
 					Text:   m.textarea.Value(),
 				}
 				m.textarea.Reset()
 			} else {
 				outMsg = Message{
-					Sender: "Agent",
+					Sender: RoleAgent,
 					Text:   m.agentTextarea.Value(),
 				}
 				m.agentTextarea.Reset()
-			}
 
-			m.messages = append(m.messages, outMsg)
-			m.messageChan <- MessageContext{
-				Current: outMsg,
-				History: m.messages,
+				if len(c.drafts) > 0 {
+					outcome := DraftEdited
+					if outMsg.Text == c.drafts[c.draftIdx] {
+						outcome = DraftAccepted
+					}
+					m.addMessages(c, Message{Sender: RoleDraft, Text: c.drafts[c.draftIdx], Outcome: outcome})
+					c.drafts = nil
+				}
 			}
 
+			m.addMessages(c, outMsg)
+
 			m.viewport.SetContent(m.messageContent())
 			m.viewport.GotoBottom()
 		}
+	case openChatMsg:
+		m.chats = append(m.chats, newChat(msg.Session))
+	case sessionMsg:
+		target := m.chatFor(msg.SessionID)
+		if target == nil {
+			log.Printf("Dropping message for unknown session %s: %#v", msg.SessionID, msg.Msg)
+			break
+		}
+		m = m.updateChat(target, msg.Msg)
+	default:
+		m = m.updateChat(c, msg)
+	}
+
+	// log.Printf("Model.Returning:\n\t%#v\n\t%#v\n\t%#v", tiCmd, vpCmd, ivpCmd)
+
+	return m, tea.Batch(tiCmd, vpCmd, ivpCmd)
+}
+
+// updateChat applies a msg produced by the AIClient to conversation c.
+func (m Model) updateChat(c *chat, msg tea.Msg) Model {
+	active := c == m.chat()
+
+	switch msg := msg.(type) {
 	case errMsg:
-		m.err = msg
-		return m, nil
-	case Message:
-		log.Printf("Processing message: %v", msg)
-		m.messages = append(m.messages, msg)
-		m.messageChan <- MessageContext{
-			Current: msg,
-			History: m.messages,
+		c.err = msg
+	case streamChunkMsg:
+		c.streaming += string(msg)
+	case streamEndMsg:
+		c.streaming = ""
+	case tokenBudgetMsg:
+		c.tokens = msg
+	case usageMsg:
+		c.usage = msg
+	case confidenceMsg:
+		confidence := float64(msg)
+		c.confidence = &confidence
+	case agentStartedMsg:
+		c.run = &msg
+		c.err = nil
+	case agentStepMsg:
+		c.agentStatus = fmt.Sprintf("Agent step %d/%d", msg.Step, msg.Max)
+		c.unavailable = false
+	case agentStoppedMsg:
+		c.agentStatus = fmt.Sprintf("Agent stopped after %d steps: %s", msg.Steps, msg.Reason)
+		c.run = nil
+		c.unavailable = msg.Reason == StopUnavailable
+		if c.unavailable {
+			c.agentStatus = "AI unavailable — escalated to human"
+			c.unread++
 		}
-		m.backendChan <- MessageContext{
-			Current: msg,
-			History: m.messages,
+		m = m.clearPending(c)
+	case draftsMsg:
+		if len(c.drafts) > 0 {
+			m.addMessages(c, Message{Sender: RoleDraft, Text: c.drafts[c.draftIdx], Outcome: DraftDiscarded})
 		}
-		m.internalViewport.SetContent(m.internalContent())
-		m.internalViewport.GotoBottom()
-		m.viewport.SetContent(m.messageContent())
-		m.viewport.GotoBottom()
-	case Messages:
-		log.Printf("Received messages: %v", msg)
-		for _, a := range msg {
-			log.Printf("Processing message: %v", a)
-			m.messages = append(m.messages, a)
-			m.messageChan <- MessageContext{
-				Current: a,
-				History: m.messages,
-			}
-			m.backendChan <- MessageContext{
-				Current: a,
-				History: m.messages,
-			}
+		c.drafts = msg.Drafts
+		c.draftIdx = 0
+		c.unread++
+		if active {
+			m.textarea.Blur()
+			m.agentTextarea.Focus()
+			m.agentTextarea.SetValue(c.drafts[0])
 		}
-		m.internalViewport.SetContent(m.internalContent())
-		m.internalViewport.GotoBottom()
-		m.viewport.SetContent(m.messageContent())
-		m.viewport.GotoBottom()
-		// case AIMsg:
-		// 	outMsg := Message{
-		// 		Sender: "AI",
-		// 		Text:   msg.text,
-		// 	}
-		// 	m.messages = append(m.messages, outMsg)
-		// 	m.backendChan <- MessageContext{
-		// 		Current: outMsg,
-		// 		History: m.messages,
-		// 	}
-		// 	m.internalViewport.SetContent(m.internalContent())
-		// 	m.internalViewport.GotoBottom()
-		// case BackendMsg:
-		// 	outMsg := Message{
-		// 		Sender: "Backend",
-		// 		Text:   msg.text,
-		// 	}
-		// 	m.messages = append(m.messages, outMsg)
-		// 	m.messageChan <- MessageContext{
-		// 		Current: outMsg,
-		// 		History: m.messages,
-		// 	}
-		// 	m.internalViewport.SetContent(m.internalContent())
-		// 	m.internalViewport.GotoBottom()
-		// case AgentMsg:
-		// 	m.messages = append(m.messages, Message{
-		// 		Sender: "Agent",
-		// 		Text:   msg.text,
-		// 	})
-		// 	m.viewport.SetContent(m.messageContent())
-		// 	m.viewport.GotoBottom()
+	case approvalRequestMsg:
+		c.pending = &msg
+		c.unread++
+	case approvalExpiredMsg:
+		c.agentStatus = fmt.Sprintf("%s was not approved in time", msg.Action.Text)
+		m = m.clearPending(c)
+	case customerMsg:
+		outMsg := Message{Sender: RoleCustomer, Text: msg.Text}
+		m.addMessages(c, outMsg)
+		c.unread++
+	case Message:
+		m.addMessages(c, msg)
+		c.unread++
+	case Messages:
+		m.addMessages(c, msg...)
+		c.unread += len(msg)
+	default:
+		return m
 	}
 
-	// log.Printf("Model.Returning:\n\t%#v\n\t%#v\n\t%#v", tiCmd, vpCmd, ivpCmd)
+	if active {
+		c.unread = 0
+		m.refresh()
+	}
 
-	return m, tea.Batch(tiCmd, vpCmd, ivpCmd)
+	return m
+}
+
+func (m *Model) focusedTextarea() *textarea.Model {
+	if m.textarea.Focused() {
+		return &m.textarea
+	}
+	return &m.agentTextarea
+}
+
+// switchPrompt handles "/prompt <name>". Without a name it lists the
+// available templates.
+func (m *Model) switchPrompt(c *chat, name string) {
+	if m.prompts == nil {
+		c.agentStatus = "No prompt templates configured"
+		return
+	}
+
+	available := strings.Join(m.prompts.Names(), ", ")
+	switch _, ok := m.prompts.Get(name); {
+	case name == "":
+		c.agentStatus = "Prompts: " + available
+	case !ok:
+		c.agentStatus = fmt.Sprintf("Unknown prompt %q. Prompts: %s", name, available)
+	default:
+		c.prompt = name
+		c.agentStatus = "Switched to prompt " + name
+	}
+}
+
+func (m Model) clearPending(c *chat) Model {
+	c.pending = nil
+	c.editing = false
+	if c == m.chat() {
+		m.refresh()
+	}
+	return m
+}
+
+// addMessages records msgs in c and publishes them on the bus.
+func (m *Model) addMessages(c *chat, msgs ...Message) {
+	msgs, err := c.add(msgs...)
+	if err != nil {
+		c.err = err
+	}
+	for _, msg := range msgs {
+		m.bus.Publish(messageEvent(c.session.ID, msg, c.messages, c.prompt))
+	}
 }
 
 func (m Model) messageContent() string {
 	var sb strings.Builder
 
-	for _, msg := range m.messages {
-		if msg.Sender == "You" || msg.Sender == "Agent" {
+	for _, msg := range m.chat().messages {
+		if msg.Sender.CustomerVisible() {
 			var ssb strings.Builder
-			if msg.Sender == "You" {
-				ssb.WriteString(m.senderStyle.Render(msg.Sender))
+			if msg.Sender == RoleCustomer {
+				ssb.WriteString(m.senderStyle.Render(msg.Sender.Label()))
 			} else {
-				ssb.WriteString(m.agentStyle.Render(msg.Sender))
+				ssb.WriteString(m.agentStyle.Render(msg.Sender.Label()))
 			}
 			ssb.WriteString(": ")
 			str, err := m.gr.Render(msg.Text)
@@ -243,7 +537,7 @@ func (m Model) messageContent() string {
 			}
 			ssb.WriteString(str)
 
-			sb.WriteString(wordwrap.String(ssb.String(), VIEW_WIDTH))
+			sb.WriteString(wordwrap.String(ssb.String(), m.viewWidth()))
 		}
 	}
 
@@ -252,22 +546,15 @@ func (m Model) messageContent() string {
 
 func (m Model) internalContent() string {
 	var sb strings.Builder
+	c := m.chat()
 
-	for _, msg := range m.messages {
-		if msg.Sender == "AI" {
-			var ssb strings.Builder
-			ssb.WriteString(m.aiStyle.Render(msg.Sender))
-			ssb.WriteString(": ")
-			str, err := m.gr.Render(msg.Text)
-			if err != nil {
-				ssb.WriteString("error rendering message")
-			}
-			ssb.WriteString(str)
+	for _, msg := range c.messages {
+		var ssb strings.Builder
+		label := msg.Sender.Label()
 
-			sb.WriteString(wordwrap.String(ssb.String(), VIEW_WIDTH))
-		} else if msg.Sender == "Action" {
-			var ssb strings.Builder
-			ssb.WriteString(m.backendStyle.Render(msg.Sender))
+		switch msg.Sender {
+		case RoleAction:
+			ssb.WriteString(m.backendStyle.Render(label))
 			ssb.WriteString(": ")
 			ssb.WriteString(msg.Text)
 			ssb.WriteString("\n")
@@ -275,49 +562,158 @@ func (m Model) internalContent() string {
 			ssb.WriteString(": ")
 			ssb.WriteString(msg.Input)
 			ssb.WriteString("\n")
-
-			sb.WriteString(wordwrap.String(ssb.String(), VIEW_WIDTH))
-		} else if msg.Sender == "Agent" {
-			var ssb strings.Builder
-			ssb.WriteString(m.aiStyle.Render(msg.Sender))
+		case RoleAgent:
+			ssb.WriteString(m.aiStyle.Render(label))
 			ssb.WriteString(": ")
 			str, err := m.gr.Render(msg.Text)
 			if err != nil {
 				ssb.WriteString("error rendering message")
 			}
 			ssb.WriteString(str)
-
-			sb.WriteString(wordwrap.String(ssb.String(), VIEW_WIDTH))
-		} else if msg.Sender == "Backend" {
-			var ssb strings.Builder
-			ssb.WriteString(m.observationStyle.Render("Observation"))
+		case RoleObservation:
+			ssb.WriteString(m.observationStyle.Render(label))
 			ssb.WriteString(": ")
 			ssb.WriteString(msg.Text)
 			ssb.WriteString("\n")
-
-			sb.WriteString(wordwrap.String(ssb.String(), VIEW_WIDTH))
-		} else if msg.Sender == "Thought" {
-			var ssb strings.Builder
-			ssb.WriteString(m.thoughtStyle.Render(msg.Sender))
+		case RoleDraft:
+			ssb.WriteString(m.agentStyle.Render(fmt.Sprintf("%s (%s)", label, msg.Outcome)))
+			ssb.WriteString(": ")
+			ssb.WriteString(msg.Text)
+			ssb.WriteString("\n")
+		case RoleCancelled, RoleIdentified:
+			ssb.WriteString(m.aiStyle.Render(label))
+			ssb.WriteString(": ")
+			ssb.WriteString(msg.Text)
+			ssb.WriteString("\n")
+		case RoleThought:
+			ssb.WriteString(m.thoughtStyle.Render(label))
 			ssb.WriteString(": ")
 			ssb.WriteString(msg.Text)
+		default:
+			continue
+		}
+
+		sb.WriteString(wordwrap.String(ssb.String(), m.viewWidth()))
+	}
 
-			sb.WriteString(wordwrap.String(ssb.String(), VIEW_WIDTH))
+	if c.pending != nil {
+		var ssb strings.Builder
+		ssb.WriteString(m.aiStyle.Render("Pending approval"))
+		ssb.WriteString(": ")
+		ssb.WriteString(c.pending.Action.Text)
+		ssb.WriteString("(")
+		ssb.WriteString(c.pending.Action.Input)
+		ssb.WriteString(")\n")
+		if c.editing {
+			ssb.WriteString("Edit the input below and press [ENTER] to approve\n")
+		} else {
+			ssb.WriteString("[CTRL+Y] approve  [CTRL+O] edit  [CTRL+R] reject\n")
 		}
 
+		sb.WriteString(wordwrap.String(ssb.String(), m.viewWidth()))
+	}
+
+	if c.streaming != "" {
+		var ssb strings.Builder
+		ssb.WriteString(m.aiStyle.Render("AI"))
+		ssb.WriteString(": ")
+		ssb.WriteString(c.streaming)
+		ssb.WriteString("\n")
+
+		sb.WriteString(wordwrap.String(ssb.String(), m.viewWidth()))
 	}
 
 	return sb.String()
 }
 
+// sidebarContent lists every conversation with its unread count.
+func (m Model) sidebarContent() string {
+	var sb strings.Builder
+
+	for i, c := range m.chats {
+		marker := "  "
+		if i == m.active {
+			marker = "▸ "
+		}
+
+		line := fmt.Sprintf("%s%d. %s", marker, i+1, c.title())
+		if c.unavailable {
+			line += " !"
+		}
+		if c.unread > 0 {
+			line = fmt.Sprintf("%s (%d)", line, c.unread)
+		}
+		line = truncate(line, SIDEBAR_WIDTH-1)
+
+		if i == m.active {
+			sb.WriteString(m.senderStyle.Render(line))
+		} else if c.unavailable {
+			sb.WriteString(m.aiStyle.Render(line))
+		} else if c.unread > 0 || c.pending != nil || len(c.drafts) > 0 {
+			sb.WriteString(m.agentStyle.Render(line))
+		} else {
+			sb.WriteString(line)
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("\n[ALT+N] new\n[ALT+↑/↓] switch\n")
+
+	return lipgloss.NewStyle().Width(SIDEBAR_WIDTH).Height(m.ui.Height).Render(sb.String())
+}
+
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	return string(runes[:width-1]) + "…"
+}
+
 func (m Model) View() string {
+	c := m.chat()
+
 	out := fmt.Sprintf(
 		"%s\n\n%s",
-		lipgloss.JoinHorizontal(lipgloss.Top, m.viewport.View(), m.internalViewport.View()),
-		lipgloss.JoinHorizontal(lipgloss.Top, m.textarea.View(), m.agentTextarea.View()),
+		lipgloss.JoinHorizontal(lipgloss.Top, m.sidebarContent(), m.viewport.View(), m.internalViewport.View()),
+		lipgloss.JoinHorizontal(lipgloss.Top, strings.Repeat(" ", SIDEBAR_WIDTH), m.textarea.View(), m.agentTextarea.View()),
 	) + "\n\n"
-	if m.err != nil {
-		out += m.err.Error()
+	if len(c.drafts) > 0 {
+		out += m.agentStyle.Render(fmt.Sprintf("Draft %d/%d: [ENTER] send  [TAB] next draft  [SHIFT+TAB] switch box  [CTRL+X] discard", c.draftIdx+1, len(c.drafts))) + "\n"
+	}
+	if c.unavailable {
+		out += m.aiStyle.Render(c.agentStatus) + "\n"
+	} else if c.run != nil {
+		out += m.thoughtStyle.Render(c.agentStatus+"  [CTRL+G] cancel") + "\n"
+	} else if c.agentStatus != "" {
+		out += m.thoughtStyle.Render(c.agentStatus) + "\n"
+	}
+	for _, metrics := range m.bus.Metrics() {
+		if metrics.Dropped > 0 {
+			out += m.aiStyle.Render("Falling behind: "+metrics.String()) + "\n"
+		}
+	}
+	if m.prompts != nil {
+		prompt := c.prompt
+		if prompt == "" {
+			prompt = m.defaultPrompt
+		}
+		out += m.thoughtStyle.Render(fmt.Sprintf("Prompt %s (/prompt <name> to switch)", prompt)) + "\n"
+	}
+	if c.confidence != nil {
+		out += m.thoughtStyle.Render(fmt.Sprintf("Confidence %.2f", *c.confidence)) + "\n"
+	}
+	if c.tokens.Limit > 0 {
+		out += m.thoughtStyle.Render(fmt.Sprintf("Context %d/%d tokens", c.tokens.Used, c.tokens.Limit)) + "\n"
+	}
+	if c.usage.Session.Calls > 0 {
+		out += m.thoughtStyle.Render(fmt.Sprintf(
+			"Session $%.4f (%d tokens, %d calls) · Today $%.4f",
+			c.usage.Session.Cost, c.usage.Session.TotalTokens, c.usage.Session.Calls, c.usage.Day.Cost,
+		)) + "\n"
+	}
+	if c.err != nil {
+		out += c.err.Error()
 	}
 	return out
 }
@@ -0,0 +1,314 @@
+package clichat
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrOrderNotFound   = errors.New("order not found")
+	ErrAlreadyReturned = errors.New("order already returned")
+)
+
+// OrderStore is where the OrderSearch and ReturnOrderFlow tools read and
+// write order data.
+type OrderStore interface {
+	OrdersByEmail(ctx context.Context, email string) ([]Order, error)
+	OrdersByPhone(ctx context.Context, phone string) ([]Order, error)
+	OrderByNumber(ctx context.Context, number string) (Order, error)
+	InitiateReturn(ctx context.Context, number string) error
+}
+
+var demoOrders = []Order{
+	{
+		OrderNumber: "123456",
+		Items: []OrderItem{
+			{
+				ProductDesc: "Brown Pants",
+				Quantity:    1,
+			},
+			{
+				ProductDesc: "Purple shirt",
+				Quantity:    1,
+			},
+		},
+		OrderDate:     "2021-01-01",
+		CustomerEmail: "jpozdena@gmail.com",
+		CustomerPhone: "5033480170",
+	},
+	{
+		OrderNumber: "654321",
+		Items: []OrderItem{
+			{
+				ProductDesc: "Green underwear",
+				Quantity:    1,
+			},
+			{
+				ProductDesc: "Red socks",
+				Quantity:    1,
+			},
+		},
+		OrderDate:     "2023-04-10",
+		CustomerEmail: "jpozdena@gmail.com",
+		CustomerPhone: "5033480170",
+	},
+}
+
+// NewOrderStore builds a store from a startup spec: empty for the demo
+// data, an http(s) URL for a REST service, or a path to a .json or .csv
+// file.
+func NewOrderStore(spec string) (OrderStore, error) {
+	switch {
+	case spec == "":
+		return NewMemoryOrderStore(demoOrders), nil
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return NewHTTPOrderStore(spec), nil
+	}
+	return LoadOrderFile(spec)
+}
+
+// normalizePhone strips everything but digits so "(503) 348-0170" and
+// "5033480170" match.
+func normalizePhone(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+}
+
+type MemoryOrderStore struct {
+	mu       sync.Mutex
+	orders   []Order
+	returned map[string]bool
+}
+
+func NewMemoryOrderStore(orders []Order) *MemoryOrderStore {
+	return &MemoryOrderStore{
+		orders:   append([]Order{}, orders...),
+		returned: map[string]bool{},
+	}
+}
+
+func (s *MemoryOrderStore) OrdersByEmail(ctx context.Context, email string) ([]Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := []Order{}
+	for _, o := range s.orders {
+		if email != "" && strings.EqualFold(o.CustomerEmail, email) {
+			out = append(out, o)
+		}
+	}
+	return out, nil
+}
+
+func (s *MemoryOrderStore) OrdersByPhone(ctx context.Context, phone string) ([]Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	phone = normalizePhone(phone)
+	out := []Order{}
+	for _, o := range s.orders {
+		if phone != "" && normalizePhone(o.CustomerPhone) == phone {
+			out = append(out, o)
+		}
+	}
+	return out, nil
+}
+
+func (s *MemoryOrderStore) OrderByNumber(ctx context.Context, number string) (Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, o := range s.orders {
+		if o.OrderNumber == number {
+			return o, nil
+		}
+	}
+	return Order{}, ErrOrderNotFound
+}
+
+func (s *MemoryOrderStore) InitiateReturn(ctx context.Context, number string) error {
+	if _, err := s.OrderByNumber(ctx, number); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.returned[number] {
+		return ErrAlreadyReturned
+	}
+	s.returned[number] = true
+	return nil
+}
+
+// LoadOrderFile reads orders from a JSON array of Order objects or a CSV
+// file with the header
+//
+//	order_number,order_date,customer_email,customer_phone,product_desc,quantity
+//
+// where an order with several items spans several rows. Returns are only
+// tracked in memory.
+func LoadOrderFile(path string) (*MemoryOrderStore, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var orders []Order
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.NewDecoder(f).Decode(&orders)
+	case ".csv":
+		orders, err = readOrderCSV(f)
+	default:
+		return nil, fmt.Errorf("unsupported order file %s: want .json or .csv", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	return NewMemoryOrderStore(orders), nil
+}
+
+var orderCSVHeader = []string{"order_number", "order_date", "customer_email", "customer_phone", "product_desc", "quantity"}
+
+func readOrderCSV(r io.Reader) ([]Order, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return []Order{}, nil
+	}
+
+	col := map[string]int{}
+	for i, name := range rows[0] {
+		col[strings.TrimSpace(name)] = i
+	}
+	for _, name := range orderCSVHeader {
+		if _, ok := col[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+
+	orders := []Order{}
+	index := map[string]int{}
+	for n, row := range rows[1:] {
+		number := row[col["order_number"]]
+		quantity, err := strconv.Atoi(row[col["quantity"]])
+		if err != nil {
+			return nil, fmt.Errorf("row %d: invalid quantity: %w", n+2, err)
+		}
+
+		i, ok := index[number]
+		if !ok {
+			i = len(orders)
+			index[number] = i
+			orders = append(orders, Order{
+				OrderNumber:   number,
+				OrderDate:     row[col["order_date"]],
+				CustomerEmail: row[col["customer_email"]],
+				CustomerPhone: row[col["customer_phone"]],
+				Items:         []OrderItem{},
+			})
+		}
+
+		orders[i].Items = append(orders[i].Items, OrderItem{
+			ProductDesc: row[col["product_desc"]],
+			Quantity:    quantity,
+		})
+	}
+
+	return orders, nil
+}
+
+// HTTPOrderStore talks to an order service with the following REST API:
+//
+//	GET  /orders?email=...          -> [Order]
+//	GET  /orders?phone=...          -> [Order]
+//	GET  /orders/{number}           -> Order, 404 if unknown
+//	POST /orders/{number}/return    -> 2xx, 404 if unknown, 409 if already returned
+type HTTPOrderStore struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewHTTPOrderStore(baseURL string) *HTTPOrderStore {
+	return &HTTPOrderStore{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *HTTPOrderStore) OrdersByEmail(ctx context.Context, email string) ([]Order, error) {
+	orders := []Order{}
+	err := s.do(ctx, http.MethodGet, "/orders?email="+url.QueryEscape(email), &orders)
+	return orders, err
+}
+
+func (s *HTTPOrderStore) OrdersByPhone(ctx context.Context, phone string) ([]Order, error) {
+	orders := []Order{}
+	err := s.do(ctx, http.MethodGet, "/orders?phone="+url.QueryEscape(phone), &orders)
+	return orders, err
+}
+
+func (s *HTTPOrderStore) OrderByNumber(ctx context.Context, number string) (Order, error) {
+	var o Order
+	err := s.do(ctx, http.MethodGet, "/orders/"+url.PathEscape(number), &o)
+	return o, err
+}
+
+func (s *HTTPOrderStore) InitiateReturn(ctx context.Context, number string) error {
+	return s.do(ctx, http.MethodPost, "/orders/"+url.PathEscape(number)+"/return", nil)
+}
+
+func (s *HTTPOrderStore) do(ctx context.Context, method string, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrOrderNotFound
+	case resp.StatusCode == http.StatusConflict:
+		return ErrAlreadyReturned
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(body))
+	}
+
+	if out == nil || len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
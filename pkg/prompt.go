@@ -2,35 +2,39 @@ package clichat
 
 import (
 	"bytes"
+	"sort"
+	"strings"
 	"text/template"
 )
 
-// const prompt = prompt1
-const prompt = prompt2
+// DefaultPrompt is the name of the ReAct prompt used unless another one is
+// configured.
+const DefaultPrompt = "react"
 
-const prompt1 = `You are an assistant for a customer service representative. You will only respond back with a JSON object. Each of the objects will have the following keys:
+// prompt1 is the prompt for FormatJSON.
+const prompt1 = `{{define "format"}}json{{end}}You are an assistant for a customer service representative. You will only respond back with a JSON object. Each of the objects will have the following keys:
 
+thought: What you are thinking about doing and why.
 action: Which will be the action that you want to perform. The possible actions are listed below.
 data: The data you'd like to use as an input to the action.
 confidence: The confidence that you have in the action. This will be a number between 0 and 1.
 
 The possible actions are:
 
-{ "action": "response", "data": "[message to user]" }
-{ "action": "lookup_orders_by_phone_number", "data": "[user's phone number]" }
-{ "action": "lookup_orders_by_email", "data": "[user's email address]" }
-{ "action": "lookup_order_by_order_number", "data": "[order_number]" }
-{ "action": "send_return_label_for_order", "data": "[order_number]" }
-{ "action": "close_conversation", "data": "[reason for closing conversation]" }
-{ "action": "human_agent_needed", "data": "[reason for human agent needed]" }
-`
+response: reply to the customer with data as the message
+{{range .Tools}}{{.}}
+{{end}}
+For example:
 
-var tools = map[string]string{
-	"OrderSearch":       "A search engine for orders. Useful for when you need to answer questions about current events. Input should be an order id, email address or customer's phone number.",
-	"ReturnOrderFlow":   "Initiates a order return. Useful when the customer is trying to return an item and the order number is known. Input should be a order id that is confirmed by the customer.",
-	"EscalateToHuman":   "Escalates chat to a human. Useful when the customer is confused or you do not know what to do next",
-	"CloseConversation": "Closes the conversation. Useful when the customer is done talking to the agent",
-}
+{ "thought": "I need more details", "action": "response", "data": "[message to customer]", "confidence": 0.9 }
+{ "thought": "I can look this up", "action": "[one of: {{range .ToolNames}}{{.}}, {{end}}]", "data": "[input to the action]", "confidence": 0.7 }
+
+The customer can not see lines starting in Action, Observation, or Thought.
+
+The conversation so far:
+{{range .History}}
+{{.}}{{end}}
+`
 
 const prompt2 = `You are an assistant to a customer service agent focused on empathy, problem-solving, and clear communication. Answer the following questions as best you can. You have access to the following tools:
 
@@ -71,30 +75,89 @@ Begin!
 {{.}}{{end}}
 `
 
+// functionsPrompt is used with ProtocolFunctions. The tools are sent as
+// structured definitions so only the conversation is described here.
+const functionsPrompt = `You are an assistant to a customer service agent focused on empathy, problem-solving, and clear communication. Answer the following questions as best you can.
+
+The chat is in the following format:
+Customer: the input from the customer
+Agent: response from the agent
+Thought: you should always think about what to do
+Action: an action that was taken
+Observation: the result of the action
+
+The customer can not see lines starting in Action, Observation, or Thought.
+
+If you need more information from the customer respond with:
+
+Thought: you should always think about what to do
+Agent: response from the agent
+
+If you have enough information to take an action, call one of the provided tools instead.
+
+Begin!
+
+{{range .History}}
+{{.}}{{end}}
+`
+
 var promtTemplate = template.Must(template.New("prompt").Parse(prompt2))
+var functionsTemplate = template.Must(template.New("functions").Parse(functionsPrompt))
 
-func GenerateConvesationalPrompt(toolMap map[string]string, history []Message) string {
+// builtinPrompts are the conversational prompt templates that can be
+// selected by name.
+var builtinPrompts = map[string]*template.Template{
+	DefaultPrompt:       promtTemplate,
+	FormatJSON.Prompt(): template.Must(template.New("json").Parse(prompt1)),
+}
+
+func historyLines(history []Message) []string {
 	msgs := []string{}
 	for _, msg := range history {
-		var sender string
-		switch msg.Sender {
-		case "You":
-			sender = "Customer"
-		default:
-			sender = msg.Sender
+		if !msg.Sender.InPrompt() {
+			continue
 		}
-		msgs = append(msgs, sender+": "+msg.Text)
+		msgs = append(msgs, strings.TrimSuffix(FormatTranscriptLine(msg), "\n"))
 	}
+	return msgs
+}
+
+// GenerateFunctionsPrompt builds the prompt for ProtocolFunctions.
+func GenerateFunctionsPrompt(history []Message) string {
+	var bts bytes.Buffer
+	err := functionsTemplate.Execute(&bts, struct {
+		History []string
+	}{
+		History: historyLines(history),
+	})
+
+	if err != nil {
+		return err.Error()
+	}
+
+	return bts.String()
+}
+
+func GenerateConvesationalPrompt(toolMap map[string]string, history []Message) string {
+	return renderPrompt(promtTemplate, toolMap, history)
+}
+
+func renderPrompt(tmpl *template.Template, toolMap map[string]string, history []Message) string {
+	msgs := historyLines(history)
 
-	tools := []string{}
 	toolNames := []string{}
-	for name, desc := range toolMap {
-		tools = append(tools, name+": "+desc)
+	for name := range toolMap {
 		toolNames = append(toolNames, name)
 	}
+	sort.Strings(toolNames)
+
+	tools := []string{}
+	for _, name := range toolNames {
+		tools = append(tools, name+": "+toolMap[name])
+	}
 
 	var bts bytes.Buffer
-	err := promtTemplate.Execute(&bts, struct {
+	err := tmpl.Execute(&bts, struct {
 		Tools     []string
 		ToolNames []string
 		History   []string
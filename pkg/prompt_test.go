@@ -0,0 +1,92 @@
+package clichat
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var promptTools = map[string]string{
+	"OrderSearch":     "Look up a customer's orders by email or phone number.",
+	"EscalateToHuman": "Hand the conversation to a human agent.",
+}
+
+var promptTests = []struct {
+	name    string
+	tools   map[string]string
+	history []Message
+}{
+	{
+		name:  "empty",
+		tools: promptTools,
+	},
+	{
+		name:  "first message",
+		tools: promptTools,
+		history: []Message{
+			{Sender: RoleCustomer, Text: "I want to return my order"},
+		},
+	},
+	{
+		name:  "action and observation",
+		tools: promptTools,
+		history: []Message{
+			{Sender: RoleCustomer, Text: "I want to return my order, my email is jpozdena@gmail.com"},
+			{Sender: RoleThought, Text: "I should look up the orders\n"},
+			{Sender: RoleAction, Text: "OrderSearch", Input: "jpozdena@gmail.com"},
+			{Sender: RoleObservation, Text: `{"orders": [{"order_number": "123456"}]}`},
+			{Sender: RoleAgent, Text: "Should I return order 123456?"},
+			{Sender: RoleCustomer, Text: "Yes: all of it"},
+		},
+	},
+	{
+		name:  "internal messages",
+		tools: promptTools,
+		history: []Message{
+			{Sender: RoleSummary, Text: "The customer asked about order 123456."},
+			{Sender: RoleCustomer, Text: "Any news?"},
+			{Sender: RoleCancelled, Text: "cancelled by the operator"},
+			{Sender: RoleDraft, Text: "Not yet.", Outcome: DraftDiscarded},
+			{Sender: RoleAgent, Text: "It ships tomorrow."},
+		},
+	},
+	{
+		name:  "default tools",
+		tools: DefaultTools(NewMemoryOrderStore(demoOrders)).Descriptions(),
+		history: []Message{
+			{Sender: RoleCustomer, Text: "Hello"},
+		},
+	},
+}
+
+// TestGenerateConvesationalPrompt compares the prompt with the golden files
+// in testdata/prompts. Run with -update after an intended change.
+func TestGenerateConvesationalPrompt(t *testing.T) {
+	for _, tt := range promptTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GenerateConvesationalPrompt(tt.tools, tt.history)
+			golden := filepath.Join("testdata", "prompts", strings.ReplaceAll(tt.name, " ", "_")+".golden")
+
+			if *update {
+				if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%s (run go test -update to create it)", err)
+			}
+			if got != string(want) {
+				t.Errorf("prompt differs from %s:\n%s", golden, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package clichat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+type (
+	CompletionRequest struct {
+		Prompt string
+		Tools  []ToolDefinition
+		// Candidates asks for that many alternative completions. Providers
+		// that cannot sample several return just one.
+		Candidates int
+	}
+
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+		// Estimated is set when the provider reported no usage and the
+		// counts were estimated from the text.
+		Estimated bool `json:"estimated,omitempty"`
+	}
+
+	Completion struct {
+		Text         string
+		Alternatives []string
+		ToolCalls    []ToolCall
+		Usage        Usage
+		// Model is the model that produced the completion, used to price it.
+		Model string
+	}
+
+	// Provider completes a prompt against some language model.
+	Provider interface {
+		Complete(ctx context.Context, req CompletionRequest) (Completion, error)
+	}
+
+	// StreamingProvider is implemented by providers that can deliver a
+	// completion incrementally. onDelta is called with each new fragment of
+	// text and the full completion is returned once the stream ends.
+	StreamingProvider interface {
+		Provider
+		Stream(ctx context.Context, req CompletionRequest, onDelta func(string)) (Completion, error)
+	}
+
+	ProviderConfig struct {
+		Name        string  `yaml:"name" env:"CLICHAT_PROVIDER"`
+		Model       string  `yaml:"model" env:"CLICHAT_MODEL"`
+		Temperature float32 `yaml:"temperature" env:"CLICHAT_TEMPERATURE"`
+		APIKey      string  `yaml:"api_key" env:"OPENAI_API_KEY"`
+		BaseURL     string  `yaml:"base_url" env:"CLICHAT_BASE_URL"`
+		ScriptPath  string  `yaml:"script" env:"CLICHAT_SCRIPT"`
+		// FallbackModel is tried on the same provider when Model keeps
+		// failing.
+		FallbackModel string `yaml:"fallback_model" env:"CLICHAT_FALLBACK_MODEL"`
+	}
+)
+
+var ErrScriptExhausted = errors.New("scripted provider: no responses left")
+
+func NewProvider(cfg ProviderConfig) (Provider, error) {
+	switch cfg.Name {
+	case "", "openai":
+		return NewOpenAIProvider(cfg.APIKey, cfg.Model, cfg.Temperature), nil
+	case "http":
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("http provider requires a base url")
+		}
+		return NewHTTPProvider(cfg.BaseURL, cfg.APIKey, cfg.Model, cfg.Temperature), nil
+	case "scripted":
+		return LoadScriptedProvider(cfg.ScriptPath)
+	}
+
+	return nil, fmt.Errorf("unknown provider %q", cfg.Name)
+}
+
+type OpenAIProvider struct {
+	client      *openai.Client
+	model       string
+	temperature float32
+}
+
+func NewOpenAIProvider(apiKey string, model string, temperature float32) *OpenAIProvider {
+	if model == "" {
+		model = openai.GPT4
+	}
+	return &OpenAIProvider{
+		client:      openai.NewClient(apiKey),
+		model:       model,
+		temperature: temperature,
+	}
+}
+
+// NewHTTPProvider talks to any server exposing the OpenAI chat completions
+// API, e.g. a llama.cpp or vLLM instance running locally.
+func NewHTTPProvider(baseURL string, apiKey string, model string, temperature float32) *OpenAIProvider {
+	config := openai.DefaultConfig(apiKey)
+	config.BaseURL = baseURL
+	return &OpenAIProvider{
+		client:      openai.NewClientWithConfig(config),
+		model:       model,
+		temperature: temperature,
+	}
+}
+
+func (p *OpenAIProvider) chatRequest(req CompletionRequest) openai.ChatCompletionRequest {
+	chatReq := openai.ChatCompletionRequest{
+		Model:       p.model,
+		Temperature: p.temperature,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: req.Prompt,
+			},
+		},
+	}
+
+	if req.Candidates > 1 {
+		chatReq.N = req.Candidates
+	}
+
+	for _, tool := range req.Tools {
+		chatReq.Tools = append(chatReq.Tools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+
+	return chatReq
+}
+
+func (p *OpenAIProvider) Complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	resp, err := p.client.CreateChatCompletion(ctx, p.chatRequest(req))
+	if err != nil {
+		return Completion{}, err
+	}
+
+	if len(resp.Choices) == 0 {
+		return Completion{}, fmt.Errorf("%s: %w", p.model, ErrEmptyCompletion)
+	}
+
+	msg := resp.Choices[0].Message
+	toolCalls := []ToolCall{}
+	for _, call := range msg.ToolCalls {
+		toolCalls = append(toolCalls, ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+
+	alternatives := []string{}
+	for _, choice := range resp.Choices[1:] {
+		alternatives = append(alternatives, choice.Message.Content)
+	}
+
+	return Completion{
+		Text:         msg.Content,
+		Alternatives: alternatives,
+		ToolCalls:    toolCalls,
+		Usage: Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+		Model: resp.Model,
+	}, nil
+}
+
+func (p *OpenAIProvider) Stream(ctx context.Context, req CompletionRequest, onDelta func(string)) (Completion, error) {
+	chatReq := p.chatRequest(req)
+	chatReq.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+
+	stream, err := p.client.CreateChatCompletionStream(ctx, chatReq)
+	if err != nil {
+		return Completion{}, err
+	}
+	defer stream.Close()
+
+	var sb strings.Builder
+	var usage Usage
+	toolCalls := []ToolCall{}
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Completion{Text: sb.String()}, err
+		}
+
+		// The last chunk carries the usage of the whole request and no
+		// choices.
+		if resp.Usage != nil {
+			usage = Usage{
+				PromptTokens:     resp.Usage.PromptTokens,
+				CompletionTokens: resp.Usage.CompletionTokens,
+				TotalTokens:      resp.Usage.TotalTokens,
+			}
+		}
+
+		for _, choice := range resp.Choices {
+			if choice.Index != 0 {
+				continue
+			}
+
+			// Tool calls arrive in fragments keyed by index; the first
+			// fragment carries the id and name, later ones the arguments.
+			for _, call := range choice.Delta.ToolCalls {
+				idx := len(toolCalls) - 1
+				if call.Index != nil {
+					idx = *call.Index
+				} else if idx < 0 {
+					idx = 0
+				}
+				for len(toolCalls) <= idx {
+					toolCalls = append(toolCalls, ToolCall{})
+				}
+				if call.ID != "" {
+					toolCalls[idx].ID = call.ID
+				}
+				toolCalls[idx].Name += call.Function.Name
+				toolCalls[idx].Arguments += call.Function.Arguments
+			}
+
+			if choice.Delta.Content != "" {
+				sb.WriteString(choice.Delta.Content)
+				onDelta(choice.Delta.Content)
+			}
+		}
+	}
+
+	return Completion{Text: sb.String(), ToolCalls: toolCalls, Usage: usage, Model: p.model}, nil
+}
+
+// ScriptedProvider replays a fixed list of responses in order. It never
+// touches the network which makes it useful for tests and offline demos.
+type ScriptedProvider struct {
+	mu        sync.Mutex
+	responses []string
+	next      int
+	Prompts   []string
+}
+
+func NewScriptedProvider(responses ...string) *ScriptedProvider {
+	return &ScriptedProvider{responses: responses}
+}
+
+// LoadScriptedProvider reads a JSON array of response strings from path.
+func LoadScriptedProvider(path string) (*ScriptedProvider, error) {
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var responses []string
+	if err := json.Unmarshal(bts, &responses); err != nil {
+		return nil, fmt.Errorf("parsing script %s: %w", path, err)
+	}
+
+	return NewScriptedProvider(responses...), nil
+}
+
+func (p *ScriptedProvider) Complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.Prompts = append(p.Prompts, req.Prompt)
+
+	if p.next >= len(p.responses) {
+		return Completion{}, ErrScriptExhausted
+	}
+
+	text := p.responses[p.next]
+	p.next++
+
+	return Completion{
+		Text: text,
+		Usage: Usage{
+			PromptTokens:     len(req.Prompt) / 4,
+			CompletionTokens: len(text) / 4,
+			TotalTokens:      (len(req.Prompt) + len(text)) / 4,
+		},
+		Model: "scripted",
+	}, nil
+}
+
+// Stream delivers the scripted response one line at a time.
+func (p *ScriptedProvider) Stream(ctx context.Context, req CompletionRequest, onDelta func(string)) (Completion, error) {
+	completion, err := p.Complete(ctx, req)
+	if err != nil {
+		return completion, err
+	}
+
+	for _, line := range strings.SplitAfter(completion.Text, "\n") {
+		if line != "" {
+			onDelta(line)
+		}
+	}
+
+	return completion, nil
+}
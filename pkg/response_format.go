@@ -0,0 +1,74 @@
+package clichat
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ResponseFormat selects how the model is asked to lay out its reply with
+// ProtocolReAct and how that reply is parsed.
+type ResponseFormat string
+
+const (
+	// FormatReAct is the Thought/Action/Action Input/Agent line format.
+	FormatReAct ResponseFormat = "react"
+	// FormatJSON is a single JSON object with thought, action, data and
+	// confidence keys.
+	FormatJSON ResponseFormat = "json"
+)
+
+// jsonResponseAction is the action the JSON format uses to reply to the
+// customer.
+const jsonResponseAction = "response"
+
+// Prompt is the name of the builtin prompt written for the format.
+func (f ResponseFormat) Prompt() string {
+	if f == FormatJSON {
+		return "json"
+	}
+	return DefaultPrompt
+}
+
+func (f ResponseFormat) Parse(text string) AiResponse {
+	if f == FormatJSON {
+		return ParseJSONResponse(text)
+	}
+	return ParseResponse(text)
+}
+
+// ParseJSONResponse reads a reply in the prompt1 format. Text around the
+// JSON object, such as a markdown code fence, is ignored. If no object can
+// be read the raw text is returned as a Thought so the operator can see it.
+func ParseJSONResponse(text string) AiResponse {
+	var reply struct {
+		Thought    string          `json:"thought"`
+		Action     string          `json:"action"`
+		Data       json.RawMessage `json:"data"`
+		Confidence *float64        `json:"confidence"`
+	}
+
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end < start || json.Unmarshal([]byte(text[start:end+1]), &reply) != nil {
+		return AiResponse{Thought: "Unparseable response: " + strings.TrimSpace(text)}
+	}
+
+	response := AiResponse{
+		Thought:    reply.Thought,
+		Confidence: reply.Confidence,
+	}
+
+	data := string(reply.Data)
+	var s string
+	if json.Unmarshal(reply.Data, &s) == nil {
+		data = s
+	}
+
+	if reply.Action == jsonResponseAction {
+		response.Agent = data
+	} else {
+		response.Action = reply.Action
+		response.ActionInput = data
+	}
+
+	return response
+}
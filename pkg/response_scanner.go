@@ -7,42 +7,71 @@ import (
 
 type AiResponse struct {
 	Action      string `json:"action"`
-	actionIdx   int
 	ActionInput string `json:"action_input"`
 	Agent       string `json:"agent"`
 	Thought     string `json:"thought"`
+	// Confidence is the model's own estimate between 0 and 1, or nil if the
+	// response format has none.
+	Confidence *float64 `json:"confidence,omitempty"`
 }
 
+// ParseResponse reads a reply in the ReAct format. Lines without a known
+// prefix continue the Thought or Agent line before them. Parsing stops at
+// the first Action Input after an Action, whatever lines come between
+// them, or at a Customer or Observation line the model made up. An Action
+// Input before any Action is ignored.
 func ParseResponse(text string) AiResponse {
 	scanner := bufio.NewScanner(strings.NewReader(text))
 
 	response := AiResponse{}
-	idx := 0
+	// current is the field continuation lines are appended to and blank
+	// is set when a blank line separates them.
+	var current *string
+	blank := false
 	for scanner.Scan() {
 		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			blank = current != nil
+			continue
+		}
+
 		parts := strings.Split(line, ":")
 		event := parts[0]
 		data := strings.TrimSpace(strings.Join(parts[1:], ":"))
+		if len(parts) == 1 {
+			event = ""
+		}
 
 		switch event {
 		case "Action":
 			response.Action = data
-			response.actionIdx = idx
+			current = nil
 		case "Action Input":
-			if idx == response.actionIdx+1 {
+			if response.Action != "" {
 				response.ActionInput = data
 				return response
-			} else {
-				response.ActionInput = ""
-				response.actionIdx = 0
 			}
+			current = nil
 		case "Agent":
 			response.Agent = data
+			current = &response.Agent
 		case "Thought":
 			response.Thought += data + "\n"
+			current = &response.Thought
+		case RoleCustomer.PromptLabel(), RoleObservation.PromptLabel():
+			return response
+		default:
+			if current == &response.Thought {
+				response.Thought += strings.TrimSpace(line) + "\n"
+			} else if current != nil {
+				if blank {
+					*current += "\n"
+				}
+				*current += "\n" + strings.TrimRight(line, " \t")
+			}
 		}
 
-		idx++
+		blank = false
 	}
 
 	return response
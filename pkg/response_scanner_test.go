@@ -0,0 +1,155 @@
+package clichat
+
+import (
+	"strings"
+	"testing"
+)
+
+var parseResponseTests = []struct {
+	name string
+	text string
+	want AiResponse
+}{
+	{
+		name: "reply",
+		text: "Thought: The customer said hello\nAgent: Hi, how can I help?",
+		want: AiResponse{Thought: "The customer said hello\n", Agent: "Hi, how can I help?"},
+	},
+	{
+		name: "action",
+		text: "Thought: I should look up the orders\nAction: OrderSearch\nAction Input: jpozdena@gmail.com",
+		want: AiResponse{Thought: "I should look up the orders\n", Action: "OrderSearch", ActionInput: "jpozdena@gmail.com"},
+	},
+	{
+		name: "multi-line thought",
+		text: "Thought: The customer wants a refund\nThought: I need their order number\nAgent: What is your order number?",
+		want: AiResponse{Thought: "The customer wants a refund\nI need their order number\n", Agent: "What is your order number?"},
+	},
+	{
+		name: "thought continued without prefix",
+		text: "Thought: The customer wants a refund\n  but I need their order number first\nAgent: What is your order number?",
+		want: AiResponse{Thought: "The customer wants a refund\nbut I need their order number first\n", Agent: "What is your order number?"},
+	},
+	{
+		name: "multi-line reply",
+		text: "Agent: You have two orders:\n- 123456: Blue pants\n- 654321: Red socks\n\nWhich one should I return?",
+		want: AiResponse{Agent: "You have two orders:\n- 123456: Blue pants\n- 654321: Red socks\n\nWhich one should I return?"},
+	},
+	{
+		name: "action input after blank line",
+		text: "Action: OrderLookup\n\nAction Input: 123456",
+		want: AiResponse{Action: "OrderLookup", ActionInput: "123456"},
+	},
+	{
+		name: "action input not adjacent",
+		text: "Action: OrderLookup\nThought: I should check first\nAction Input: 123456",
+		want: AiResponse{Action: "OrderLookup", ActionInput: "123456", Thought: "I should check first\n"},
+	},
+	{
+		name: "action input after a continuation line",
+		text: "Action: OrderLookup\nthe order from the email\nAction Input: 123456",
+		want: AiResponse{Action: "OrderLookup", ActionInput: "123456"},
+	},
+	{
+		name: "action input before action",
+		text: "Action Input: 123456\nAction: OrderLookup",
+		want: AiResponse{Action: "OrderLookup"},
+	},
+	{
+		name: "action input without action",
+		text: "Thought: hmm\nAction Input: 123456",
+		want: AiResponse{Thought: "hmm\n"},
+	},
+	{
+		name: "colons in input",
+		text: "Action: ReturnOrderFlow\nAction Input: order: 123456, note: \"size: M\"",
+		want: AiResponse{Action: "ReturnOrderFlow", ActionInput: "order: 123456, note: \"size: M\""},
+	},
+	{
+		name: "url in reply",
+		text: "Agent: Track it at https://example.com/track?id=1",
+		want: AiResponse{Agent: "Track it at https://example.com/track?id=1"},
+	},
+	{
+		name: "stops at action input",
+		text: "Action: OrderSearch\nAction Input: jpozdena@gmail.com\nObservation: {}\nAgent: Found them",
+		want: AiResponse{Action: "OrderSearch", ActionInput: "jpozdena@gmail.com"},
+	},
+	{
+		name: "made up conversation",
+		text: "Agent: Anything else?\nCustomer: No thanks\nAgent: Bye",
+		want: AiResponse{Agent: "Anything else?"},
+	},
+	{
+		name: "made up observation",
+		text: "Thought: I know the answer\nObservation: order shipped\nAgent: It shipped",
+		want: AiResponse{Thought: "I know the answer\n"},
+	},
+	{
+		name: "missing action input",
+		text: "Thought: Time to escalate\nAction: EscalateToHuman",
+		want: AiResponse{Thought: "Time to escalate\n", Action: "EscalateToHuman"},
+	},
+	{
+		name: "missing fields",
+		text: "I'm not sure what to do here.",
+		want: AiResponse{},
+	},
+	{
+		name: "empty",
+		text: "",
+		want: AiResponse{},
+	},
+	{
+		name: "windows line endings",
+		text: "Thought: I should look up the orders\r\nAction: OrderSearch\r\nAction Input: jpozdena@gmail.com\r\n",
+		want: AiResponse{Thought: "I should look up the orders\n", Action: "OrderSearch", ActionInput: "jpozdena@gmail.com"},
+	},
+	{
+		name: "windows line endings in reply",
+		text: "Agent: Line one\r\nline two\r\n",
+		want: AiResponse{Agent: "Line one\nline two"},
+	},
+	{
+		name: "surrounding whitespace",
+		text: "  \nThought:   padded   \nAgent:   Hello  \n\n",
+		want: AiResponse{Thought: "padded\n", Agent: "Hello"},
+	},
+}
+
+func TestParseResponse(t *testing.T) {
+	for _, tt := range parseResponseTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseResponse(tt.text)
+			if got != tt.want {
+				t.Errorf("ParseResponse(%q)\n got  %#v\n want %#v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzParseResponse(f *testing.F) {
+	for _, tt := range parseResponseTests {
+		f.Add(tt.text)
+	}
+
+	f.Fuzz(func(t *testing.T, text string) {
+		got := ParseResponse(text)
+
+		if got.ActionInput != "" && got.Action == "" {
+			t.Errorf("ParseResponse(%q) has an Action Input without an Action: %#v", text, got)
+		}
+		for _, line := range strings.Split(got.Agent, "\n") {
+			if strings.HasPrefix(line, "Customer:") || strings.HasPrefix(line, "Observation:") {
+				t.Errorf("ParseResponse(%q) let %q into the reply", text, line)
+			}
+		}
+
+		if !strings.Contains(text, "\r") {
+			crlf := ParseResponse(strings.ReplaceAll(text, "\n", "\r\n"))
+			if crlf != got {
+				t.Errorf("ParseResponse(%q) differs with Windows line endings\n got  %#v\n want %#v", text, crlf, got)
+			}
+		}
+	})
+}
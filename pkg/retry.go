@@ -0,0 +1,126 @@
+package clichat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	DefaultRetries     = 3
+	DefaultCallTimeout = 45 * time.Second
+	retryBackoff       = time.Second
+	maxRetryBackoff    = 20 * time.Second
+)
+
+// ErrEmptyCompletion is returned by providers when the model answered
+// without any choices.
+var ErrEmptyCompletion = errors.New("model returned no choices")
+
+// ErrAIUnavailable means every attempt against the model, and the fallback
+// model if there is one, failed.
+var ErrAIUnavailable = errors.New("AI unavailable")
+
+// retryable reports whether a failed model call is worth repeating: rate
+// limits, server errors, network errors, empty completions and calls that
+// ran out of their own deadline.
+func retryable(err error) bool {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return retryableStatus(apiErr.HTTPStatusCode)
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return retryableStatus(reqErr.HTTPStatusCode)
+	}
+
+	var netErr net.Error
+	return errors.Is(err, ErrEmptyCompletion) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &netErr)
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// backoff is the delay before retry attempt n, counting from 1. It doubles
+// with every attempt up to maxRetryBackoff.
+func backoff(n int) time.Duration {
+	d := retryBackoff << (n - 1)
+	if d <= 0 || d > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return d
+}
+
+// complete asks the provider, then the fallback provider, for a completion.
+// Each call gets CallTimeout and failures that may be transient are retried
+// with exponential backoff. Other failures, such as a bad key or a missing
+// model, go straight to the next provider. When nothing works the error
+// wraps ErrAIUnavailable.
+func (r *agentRun) complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	providers := []Provider{r.provider}
+	if r.opts.Fallback != nil {
+		providers = append(providers, r.opts.Fallback)
+	}
+
+	var err error
+	for i, provider := range providers {
+		if i > 0 {
+			r.opts.Events.Record(ctx, Event{Type: EventError, Error: fmt.Sprintf("switching to the fallback model: %s", err)})
+		}
+
+		for attempt := 1; attempt <= r.opts.Retries+1; attempt++ {
+			var resp Completion
+			resp, err = r.call(ctx, provider, req)
+			if err == nil {
+				return resp, nil
+			}
+			if ctx.Err() != nil {
+				return Completion{}, ctx.Err()
+			}
+			if !retryable(err) || attempt > r.opts.Retries {
+				break
+			}
+
+			delay := backoff(attempt)
+			r.opts.Events.Record(ctx, Event{Type: EventError, Error: fmt.Sprintf("attempt %d failed, retrying in %s: %s", attempt, delay, err)})
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return Completion{}, ctx.Err()
+			}
+		}
+	}
+
+	return Completion{}, fmt.Errorf("%w: %w", ErrAIUnavailable, err)
+}
+
+// call makes a single attempt. It streams the completion into the Model
+// when the provider supports it and falls back to a blocking call
+// otherwise.
+func (r *agentRun) call(ctx context.Context, provider Provider, req CompletionRequest) (Completion, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.opts.CallTimeout)
+	defer cancel()
+
+	// Only the first candidate can be streamed.
+	sp, ok := provider.(StreamingProvider)
+	if !ok || req.Candidates > 1 {
+		return provider.Complete(ctx, req)
+	}
+
+	defer r.out.Send(streamEndMsg{})
+	resp, err := sp.Stream(ctx, req, func(delta string) {
+		r.out.Send(streamChunkMsg(delta))
+	})
+	if err == nil && resp.Text == "" && len(resp.ToolCalls) == 0 {
+		err = ErrEmptyCompletion
+	}
+	return resp, err
+}
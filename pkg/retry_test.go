@@ -0,0 +1,62 @@
+package clichat
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// failingProvider fails every call with err.
+type failingProvider struct {
+	err   error
+	calls int
+}
+
+func (p *failingProvider) Complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	p.calls++
+	return Completion{}, p.err
+}
+
+func TestCompleteFallback(t *testing.T) {
+	badKey := &openai.APIError{HTTPStatusCode: http.StatusUnauthorized, Message: "invalid api key"}
+
+	tests := []struct {
+		name     string
+		fallback Provider
+		wantText string
+	}{
+		{
+			name:     "bad key uses the fallback",
+			fallback: NewScriptedProvider("Agent: Hello"),
+			wantText: "Agent: Hello",
+		},
+		{
+			name: "bad key without fallback",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &failingProvider{err: badKey}
+			ai := NewAIClient(&recordingSender{}, provider, nil, AIClientOptions{Retries: 1, Fallback: tt.fallback}, nil)
+			r := &agentRun{AIClient: ai, out: &recordingSender{}}
+
+			resp, err := r.complete(context.Background(), CompletionRequest{Prompt: "Customer: Hi"})
+			if provider.calls != 1 {
+				t.Errorf("provider called %d times, want 1 as a bad key is not retried", provider.calls)
+			}
+			if tt.wantText != "" {
+				if err != nil || resp.Text != tt.wantText {
+					t.Errorf("complete() = %q, %v, want %q", resp.Text, err, tt.wantText)
+				}
+				return
+			}
+			if !errors.Is(err, ErrAIUnavailable) || !errors.Is(err, badKey) {
+				t.Errorf("complete() error = %v, want ErrAIUnavailable wrapping the API error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package clichat
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Role is who, or what, wrote a Message. The values are what is stored in
+// session files.
+type Role string
+
+const (
+	RoleCustomer    Role = "You"
+	RoleAgent       Role = "Agent"
+	RoleThought     Role = "Thought"
+	RoleAction      Role = "Action"
+	RoleObservation Role = "Backend"
+	// RoleSummary stands in for earlier turns compacted to fit the context
+	// window. It only exists in prompts.
+	RoleSummary Role = "Summary"
+	// RoleDraft records what the operator did with a copilot draft and
+	// RoleCancelled marks an abandoned agent run. Neither is shown to the
+	// model.
+	RoleDraft     Role = "Draft"
+	RoleCancelled Role = "Cancelled"
+	// RoleIdentified records the customer found by CustomerLookup so it is
+	// remembered when the session is resumed.
+	RoleIdentified Role = "Identified"
+)
+
+type roleInfo struct {
+	// label is shown in the TUI and prompt is the line prefix used in
+	// prompts and transcripts. An empty prompt keeps the role out of them.
+	label   string
+	prompt  string
+	visible bool
+}
+
+var roles = map[Role]roleInfo{
+	RoleCustomer:    {label: "You", prompt: "Customer", visible: true},
+	RoleAgent:       {label: "Agent", prompt: "Agent", visible: true},
+	RoleThought:     {label: "Thought", prompt: "Thought"},
+	RoleAction:      {label: "Action", prompt: "Action"},
+	RoleObservation: {label: "Observation", prompt: "Observation"},
+	RoleSummary:     {label: "Summary", prompt: "Summary"},
+	RoleDraft:       {label: "Draft"},
+	RoleCancelled:   {label: "Cancelled"},
+	RoleIdentified:  {label: "Identified"},
+}
+
+func (r Role) Valid() bool {
+	_, ok := roles[r]
+	return ok
+}
+
+// CustomerVisible reports whether the customer sees messages of this role.
+// Everything else is internal to the operator and the agent.
+func (r Role) CustomerVisible() bool {
+	return roles[r].visible
+}
+
+// InPrompt reports whether messages of this role are part of the history
+// the model sees.
+func (r Role) InPrompt() bool {
+	return roles[r].prompt != ""
+}
+
+func (r Role) Label() string {
+	if info, ok := roles[r]; ok {
+		return info.label
+	}
+	return string(r)
+}
+
+func (r Role) PromptLabel() string {
+	if info, ok := roles[r]; ok && info.prompt != "" {
+		return info.prompt
+	}
+	return string(r)
+}
+
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r), nil
+}
+
+func (r *Role) UnmarshalText(text []byte) error {
+	role := Role(text)
+	if !role.Valid() {
+		return fmt.Errorf("unknown role %q", text)
+	}
+	*r = role
+	return nil
+}
+
+// NewMessageID returns a random id for a Message.
+func NewMessageID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// stamped gives msg an id and the current time unless it has them. It is
+// called as messages join a conversation.
+func stamped(msg Message) Message {
+	if msg.ID == "" {
+		msg.ID = NewMessageID()
+	}
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+	return msg
+}
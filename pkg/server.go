@@ -0,0 +1,228 @@
+package clichat
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const maxCustomerMessage = 280
+
+//go:embed widget.html
+var widgetHTML []byte
+
+type (
+	// openChatMsg adds a conversation started by a remote customer to the
+	// inbox.
+	openChatMsg struct {
+		Session *Session
+	}
+
+	// customerMsg is a message typed by a remote customer.
+	customerMsg struct {
+		Text string
+	}
+)
+
+// ChatServer lets customers chat over HTTP. Customer messages are delivered
+// to the TUI as if typed in the "You" box and Agent messages are streamed
+// back with server-sent events. Creating a session returns a random token
+// that the other calls must pass as ?token=; a missing or wrong token is
+// answered like an unknown session.
+//
+//	GET  /                                     chat widget
+//	POST /api/sessions                         -> {"session_id": "...", "token": "..."}
+//	POST /api/sessions/{id}/messages?token=... {"text": "..."}
+//	GET  /api/sessions/{id}/events?token=...   text/event-stream of Agent messages
+type ChatServer struct {
+	store   *SessionStore
+	program Sender
+
+	mu sync.Mutex
+	// sessions maps the id of each session created here to its token.
+	sessions    map[string]string
+	subscribers map[string][]chan Message
+}
+
+func NewChatServer(store *SessionStore) *ChatServer {
+	return &ChatServer{
+		store:       store,
+		sessions:    map[string]string{},
+		subscribers: map[string][]chan Message{},
+	}
+}
+
+// ListenAndServe serves customers on addr, delivering their messages to
+// program.
+func (s *ChatServer) ListenAndServe(addr string, program Sender) error {
+	log.Println("Chat server listening on", addr)
+	return http.ListenAndServe(addr, s.Handler(program))
+}
+
+// Handler serves the widget and the API, delivering customer messages to
+// program.
+func (s *ChatServer) Handler(program Sender) http.Handler {
+	s.program = program
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleWidget)
+	mux.HandleFunc("/api/sessions", s.handleCreate)
+	mux.HandleFunc("/api/sessions/", s.handleSession)
+	return mux
+}
+
+// Follow pushes the Agent messages published on bus to the session's
+// event streams. Slow streams miss messages rather than hold up the others.
+func (s *ChatServer) Follow(bus *Bus) {
+	sub := bus.Subscribe("chat server", 100, Only(AgentSaid{}))
+	go func() {
+		for e := range sub.Events() {
+			said := e.(AgentSaid)
+			s.push(said.SessionID, said.Message)
+		}
+	}()
+}
+
+func (s *ChatServer) push(sessionID string, msg Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sub := range s.subscribers[sessionID] {
+		select {
+		case sub <- msg:
+		default:
+			log.Printf("Chat server dropped message for slow subscriber on %s", sessionID)
+		}
+	}
+}
+
+func (s *ChatServer) handleWidget(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(widgetHTML)
+}
+
+func (s *ChatServer) handleCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session := s.store.Create()
+	token := newSessionToken()
+
+	s.mu.Lock()
+	s.sessions[session.ID] = token
+	s.mu.Unlock()
+
+	s.program.Send(openChatMsg{Session: session})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"session_id": session.ID, "token": token})
+}
+
+// newSessionToken returns 128 random bits, the only credential of a remote
+// customer.
+func newSessionToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func (s *ChatServer) handleSession(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/sessions/"), "/")
+
+	s.mu.Lock()
+	token, ok := s.sessions[id]
+	s.mu.Unlock()
+	given := r.URL.Query().Get("token")
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case action == "messages" && r.Method == http.MethodPost:
+		s.handleMessage(w, r, id)
+	case action == "events" && r.Method == http.MethodGet:
+		s.handleEvents(w, r, id)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *ChatServer) handleMessage(w http.ResponseWriter, r *http.Request, id string) {
+	var body struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	text := strings.TrimSpace(body.Text)
+	if text == "" || len([]rune(text)) > maxCustomerMessage {
+		http.Error(w, fmt.Sprintf("text must be 1-%d characters", maxCustomerMessage), http.StatusBadRequest)
+		return
+	}
+
+	s.program.Send(sessionMsg{SessionID: id, Msg: customerMsg{Text: text}})
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *ChatServer) handleEvents(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	sub := make(chan Message, 100)
+	s.mu.Lock()
+	s.subscribers[id] = append(s.subscribers[id], sub)
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		subs := s.subscribers[id]
+		for i, other := range subs {
+			if other == sub {
+				s.subscribers[id] = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case msg := <-sub:
+			data, err := json.Marshal(msg)
+			if err != nil {
+				log.Println("Chat server:", err)
+				continue
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
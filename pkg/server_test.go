@@ -0,0 +1,129 @@
+package clichat
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// recordingSender stands in for the TUI and keeps what the server sends it.
+type recordingSender struct {
+	mu   sync.Mutex
+	msgs []tea.Msg
+}
+
+func (s *recordingSender) Send(msg tea.Msg) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgs = append(s.msgs, msg)
+}
+
+func (s *recordingSender) sent() []tea.Msg {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]tea.Msg{}, s.msgs...)
+}
+
+func TestChatServer(t *testing.T) {
+	store, err := NewSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := NewBus()
+	defer bus.Close()
+
+	server := NewChatServer(store)
+	server.Follow(bus)
+	program := &recordingSender{}
+	ts := httptest.NewServer(server.Handler(program))
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/api/sessions", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created struct {
+		SessionID string `json:"session_id"`
+		Token     string `json:"token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if err != nil || created.SessionID == "" || created.Token == "" {
+		t.Fatalf("creating a session: %v, %+v", err, created)
+	}
+	base := ts.URL + "/api/sessions/" + created.SessionID
+
+	// The session id alone, or with a wrong token, must not give access.
+	for _, query := range []string{"", "?token=", "?token=0123456789abcdef0123456789abcdef"} {
+		resp, err := http.Get(base + "/events" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("events with %q: %s, want 404", query, resp.Status)
+		}
+
+		resp, err = http.Post(base+"/messages"+query, "application/json", strings.NewReader(`{"text": "Hi"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("message with %q: %s, want 404", query, resp.Status)
+		}
+	}
+
+	query := "?token=" + created.Token
+	events, err := http.Get(base + "/events" + query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer events.Body.Close()
+
+	resp, err = http.Post(base+"/messages"+query, "application/json", strings.NewReader(`{"text": "Where is my order?"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("posting a message: %s", resp.Status)
+	}
+
+	sent := program.sent()
+	if len(sent) != 2 {
+		t.Fatalf("program got %d messages, want 2: %#v", len(sent), sent)
+	}
+	if open, ok := sent[0].(openChatMsg); !ok || open.Session.ID != created.SessionID {
+		t.Errorf("first message is %#v, want openChatMsg for %s", sent[0], created.SessionID)
+	}
+	want := sessionMsg{SessionID: created.SessionID, Msg: customerMsg{Text: "Where is my order?"}}
+	if sent[1] != want {
+		t.Errorf("second message is %#v, want %#v", sent[1], want)
+	}
+
+	bus.Publish(AgentSaid{SessionID: created.SessionID, Message: Message{Sender: RoleAgent, Text: "It ships tomorrow."}})
+
+	scanner := bufio.NewScanner(events.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Sender != RoleAgent || msg.Text != "It ships tomorrow." {
+			t.Errorf("event is %+v, want the Agent reply", msg)
+		}
+		return
+	}
+	t.Fatalf("event stream ended without an Agent message: %v", scanner.Err())
+}
@@ -0,0 +1,168 @@
+package clichat
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const sessionExt = ".jsonl"
+
+// SessionStore keeps one JSONL file of messages per conversation.
+type SessionStore struct {
+	dir string
+}
+
+type SessionInfo struct {
+	ID        string
+	UpdatedAt time.Time
+	Messages  int
+	Preview   string
+}
+
+// Session is an open conversation whose messages are appended to disk as
+// they arrive.
+type Session struct {
+	ID       string
+	Messages []Message
+
+	mu   sync.Mutex
+	path string
+}
+
+func NewSessionStore(dir string) (*SessionStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &SessionStore{dir: dir}, nil
+}
+
+func NewSessionID() string {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+func (s *SessionStore) path(id string) string {
+	return filepath.Join(s.dir, id+sessionExt)
+}
+
+// Create starts a new, empty session.
+func (s *SessionStore) Create() *Session {
+	id := NewSessionID()
+	return &Session{ID: id, Messages: []Message{}, path: s.path(id)}
+}
+
+// Open loads an existing session so it can be resumed.
+func (s *SessionStore) Open(id string) (*Session, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("invalid session id %q", id)
+	}
+
+	msgs, err := readSession(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("session %s not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{ID: id, Messages: msgs, path: s.path(id)}, nil
+}
+
+// List returns every stored session, most recently updated first.
+func (s *SessionStore) List() ([]SessionInfo, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*"+sessionExt))
+	if err != nil {
+		return nil, err
+	}
+
+	infos := []SessionInfo{}
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		msgs, err := readSession(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+
+		info := SessionInfo{
+			ID:        strings.TrimSuffix(filepath.Base(path), sessionExt),
+			UpdatedAt: stat.ModTime(),
+			Messages:  len(msgs),
+		}
+		for _, msg := range msgs {
+			if msg.Sender == RoleCustomer {
+				info.Preview = msg.Text
+				break
+			}
+		}
+
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].UpdatedAt.After(infos[j].UpdatedAt) })
+
+	return infos, nil
+}
+
+// Append records msgs in memory and on disk.
+func (s *Session) Append(msgs ...Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Messages = append(s.Messages, msgs...)
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, msg := range msgs {
+		if err := enc.Encode(msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readSession(path string) ([]Message, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	msgs := []Message{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, scanner.Err()
+}
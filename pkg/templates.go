@@ -0,0 +1,191 @@
+package clichat
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// promptExt is the extension of prompt template files.
+const promptExt = ".tmpl"
+
+// formatTemplate names the block a prompt template declares its response
+// format in, e.g. {{define "format"}}json{{end}}.
+const formatTemplate = "format"
+
+// PromptLibrary holds the named conversational prompt templates. Every
+// *.tmpl file in its directory is a template named after the file; a file
+// named like a builtin prompt replaces it. Templates are executed with
+// .Tools, .ToolNames and .History, see prompt2. A template that asks for
+// anything but the react format says so in a "format" block, see prompt1;
+// replies are parsed in the format of the template that produced them.
+type PromptLibrary struct {
+	dir string
+
+	mu        sync.RWMutex
+	templates map[string]*template.Template
+	modTimes  map[string]time.Time
+}
+
+// LoadPromptLibrary loads the builtin prompts and the templates in dir. An
+// empty or missing dir leaves just the builtins.
+func LoadPromptLibrary(dir string) (*PromptLibrary, error) {
+	l := &PromptLibrary{
+		dir:       dir,
+		templates: map[string]*template.Template{},
+		modTimes:  map[string]time.Time{},
+	}
+	for name, tmpl := range builtinPrompts {
+		l.templates[name] = tmpl
+	}
+
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload re-reads the template files that changed since they were last
+// loaded. A template that fails to parse keeps its previous version and the
+// first such error is returned.
+func (l *PromptLibrary) Reload() error {
+	if l.dir == "" {
+		return nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(l.dir, "*"+promptExt))
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var firstErr error
+	seen := map[string]bool{}
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), promptExt)
+		seen[name] = true
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if modTime, ok := l.modTimes[name]; ok && modTime.Equal(info.ModTime()) {
+			continue
+		}
+
+		bts, err := os.ReadFile(path)
+		var tmpl *template.Template
+		if err == nil {
+			tmpl, err = template.New(name).Parse(string(bts))
+		}
+		if err == nil {
+			if format := templateFormat(tmpl); format != FormatReAct && format != FormatJSON {
+				err = fmt.Errorf("%s: unknown response format %q, want react or json", path, format)
+			}
+		}
+		// Remember the broken version too so it is reported only once.
+		l.modTimes[name] = info.ModTime()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		l.templates[name] = tmpl
+	}
+
+	// Files that were removed fall back to the builtin, if any.
+	for name := range l.modTimes {
+		if seen[name] {
+			continue
+		}
+		delete(l.modTimes, name)
+		delete(l.templates, name)
+		if tmpl, ok := builtinPrompts[name]; ok {
+			l.templates[name] = tmpl
+		}
+	}
+
+	return firstErr
+}
+
+// Watch reloads the library every interval until ctx is done.
+func (l *PromptLibrary) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := l.Reload(); err != nil {
+				log.Println("Reloading prompts:", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (l *PromptLibrary) Get(name string) (*template.Template, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	tmpl, ok := l.templates[name]
+	return tmpl, ok
+}
+
+func (l *PromptLibrary) Names() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	names := []string{}
+	for name := range l.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Format is the response format the named template asks the model for.
+func (l *PromptLibrary) Format(name string) (ResponseFormat, bool) {
+	tmpl, ok := l.Get(name)
+	if !ok {
+		return "", false
+	}
+	return templateFormat(tmpl), true
+}
+
+// Check reports whether name is a template written for format.
+func (l *PromptLibrary) Check(name string, format ResponseFormat) error {
+	got, ok := l.Format(name)
+	if !ok {
+		return fmt.Errorf("unknown prompt %q, want one of %s", name, strings.Join(l.Names(), ", "))
+	}
+	if got != format {
+		return fmt.Errorf("prompt %q is written for the %s response format, not %s", name, got, format)
+	}
+	return nil
+}
+
+// templateFormat is the response format declared by tmpl's format block,
+// FormatReAct if it has none.
+func templateFormat(tmpl *template.Template) ResponseFormat {
+	block := tmpl.Lookup(formatTemplate)
+	if block == nil {
+		return FormatReAct
+	}
+
+	var sb strings.Builder
+	if err := block.Execute(&sb, nil); err != nil {
+		return FormatReAct
+	}
+	return ResponseFormat(strings.TrimSpace(sb.String()))
+}
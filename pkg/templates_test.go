@@ -0,0 +1,67 @@
+package clichat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPromptLibraryFormat(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"terse.tmpl":  "Be brief.\n{{range .History}}{{.}}\n{{end}}",
+		"object.tmpl": `{{define "format"}}json{{end}}Reply with JSON.`,
+		"broken.tmpl": `{{define "format"}}yaml{{end}}Reply with YAML.`,
+	}
+	for name, text := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := LoadPromptLibrary(dir); err == nil {
+		t.Error("LoadPromptLibrary accepted a template with an unknown format")
+	}
+	os.Remove(filepath.Join(dir, "broken.tmpl"))
+
+	prompts, err := LoadPromptLibrary(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		prompt string
+		format ResponseFormat
+		ok     bool
+	}{
+		{prompt: DefaultPrompt, format: FormatReAct, ok: true},
+		{prompt: FormatJSON.Prompt(), format: FormatJSON, ok: true},
+		{prompt: "terse", format: FormatReAct, ok: true},
+		{prompt: "object", format: FormatJSON, ok: true},
+		{prompt: "terse", format: FormatJSON},
+		{prompt: FormatJSON.Prompt(), format: FormatReAct},
+		{prompt: "missing", format: FormatReAct},
+	}
+	for _, tt := range tests {
+		err := prompts.Check(tt.prompt, tt.format)
+		if (err == nil) != tt.ok {
+			t.Errorf("Check(%q, %q) = %v, want ok %v", tt.prompt, tt.format, err, tt.ok)
+		}
+	}
+}
+
+// A conversation switched to a prompt of another format must be parsed in
+// that format.
+func TestParseFollowsPrompt(t *testing.T) {
+	ai := NewAIClient(&recordingSender{}, NewScriptedProvider(), nil, AIClientOptions{}, nil)
+
+	react := ai.parse(DefaultPrompt, Completion{Text: "Thought: hi\nAgent: Hello"})
+	if react.Agent != "Hello" {
+		t.Errorf("react prompt parsed as %#v", react)
+	}
+
+	json := ai.parse(FormatJSON.Prompt(), Completion{Text: `{"thought": "hi", "action": "response", "data": "Hello"}`})
+	if json.Agent != "Hello" {
+		t.Errorf("json prompt parsed as %#v", json)
+	}
+}
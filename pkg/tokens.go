@@ -0,0 +1,164 @@
+package clichat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultContextWindow = 8192
+
+	// completionReserve is kept free in the context window for the reply.
+	completionReserve = 1024
+
+	// maxObservationChars is how much of an older Backend observation is
+	// kept once the history has to be compacted.
+	maxObservationChars = 500
+)
+
+// contextWindows is the size in tokens of each model's context window.
+// Unlisted models match the longest listed prefix.
+var contextWindows = map[string]int{
+	"gpt-3.5-turbo":     4096,
+	"gpt-3.5-turbo-16k": 16384,
+	"gpt-4":             8192,
+	"gpt-4-32k":         32768,
+	"gpt-4-turbo":       128000,
+	"gpt-4o":            128000,
+}
+
+// tokenBudgetMsg reports how much of the context window the latest prompt
+// used.
+type tokenBudgetMsg struct {
+	Used  int
+	Limit int
+}
+
+// ContextWindow returns the context window of model in tokens.
+func ContextWindow(model string) int {
+	best, window := "", DefaultContextWindow
+	for prefix, size := range contextWindows {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best, window = prefix, size
+		}
+	}
+	return window
+}
+
+// EstimateTokens approximates the number of tokens in text using the rule
+// of thumb of four characters per token.
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+func requestTokens(req CompletionRequest) int {
+	tokens := EstimateTokens(req.Prompt)
+	if len(req.Tools) > 0 {
+		bts, _ := json.Marshal(req.Tools)
+		tokens += EstimateTokens(string(bts))
+	}
+	return tokens
+}
+
+// fit builds the request for history, compacting the history until the
+// prompt leaves room for the reply:
+//
+//  1. truncate Backend observations from earlier turns,
+//  2. drop the Thoughts, Actions and observations of earlier turns,
+//  3. replace the earlier turns with a summary written by the model.
+//
+// The current turn, from the latest customer message on, is never touched.
+func (r *agentRun) fit(ctx context.Context, history []Message) CompletionRequest {
+	limit := r.opts.ContextWindow - completionReserve
+
+	req := r.request(r.prompt, history)
+	stages := []func(context.Context, []Message, int) []Message{
+		truncateObservations,
+		dropInternal,
+		r.summarize,
+	}
+	for _, compact := range stages {
+		if requestTokens(req) <= limit {
+			break
+		}
+		history = compact(ctx, history, currentTurn(history))
+		req = r.request(r.prompt, history)
+	}
+
+	r.out.Send(tokenBudgetMsg{Used: requestTokens(req), Limit: limit})
+	return req
+}
+
+// currentTurn returns the index of the latest customer message.
+func currentTurn(history []Message) int {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Sender == RoleCustomer {
+			return i
+		}
+	}
+	return 0
+}
+
+func truncateObservations(ctx context.Context, history []Message, turn int) []Message {
+	out := append([]Message{}, history...)
+	for i := range out[:turn] {
+		if text := []rune(out[i].Text); out[i].Sender == RoleObservation && len(text) > maxObservationChars {
+			out[i].Text = string(text[:maxObservationChars]) + " …(truncated)"
+		}
+	}
+	return out
+}
+
+func dropInternal(ctx context.Context, history []Message, turn int) []Message {
+	out := []Message{}
+	for i, msg := range history {
+		if i < turn && !msg.Sender.CustomerVisible() && msg.Sender != RoleSummary {
+			continue
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+const summaryPrompt = `Summarize the following customer service conversation in a few sentences. Keep every order number, email address, phone number and decision that was made.
+
+%s
+
+Summary:`
+
+// summarize replaces everything before the current turn with a Summary
+// message. The summary is cached on the Conversation so it is only written
+// once per turn. If the model fails the history is returned unchanged.
+func (r *agentRun) summarize(ctx context.Context, history []Message, turn int) []Message {
+	if turn == 0 {
+		return history
+	}
+
+	older := history[:turn]
+	conversation := ConversationFrom(ctx)
+	summary, ok := conversation.Summary(len(older))
+	if !ok {
+		req := CompletionRequest{
+			Prompt: fmt.Sprintf(summaryPrompt, strings.Join(historyLines(older), "\n")),
+		}
+		start := time.Now()
+		callCtx, cancel := context.WithTimeout(ctx, r.opts.CallTimeout)
+		resp, err := r.provider.Complete(callCtx, req)
+		cancel()
+		if err != nil {
+			r.opts.Events.Record(ctx, Event{Type: EventError, Sender: string(RoleSummary), Error: err.Error()})
+			return history
+		}
+
+		usage := r.account(req, resp)
+		r.opts.Events.Record(ctx, Event{Type: EventCompletion, Sender: string(RoleSummary), Text: resp.Text, Latency: time.Since(start), Usage: &usage})
+
+		summary = strings.TrimSpace(resp.Text)
+		conversation.SetSummary(len(older), summary)
+	}
+
+	return append([]Message{{Sender: RoleSummary, Text: summary}}, history[turn:]...)
+}
@@ -0,0 +1,176 @@
+package clichat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// ToolProtocol selects how tools are described to the model and how its
+// chosen action is read back.
+type ToolProtocol string
+
+const (
+	// ProtocolReAct lists the tools in the prompt and scrapes the
+	// Action / Action Input lines out of the reply.
+	ProtocolReAct ToolProtocol = "react"
+	// ProtocolFunctions sends the tools as structured function definitions
+	// and reads the model's tool calls directly.
+	ProtocolFunctions ToolProtocol = "functions"
+)
+
+type (
+	ToolDefinition struct {
+		Name        string
+		Description string
+		Parameters  map[string]any
+	}
+
+	ToolCall struct {
+		ID        string
+		Name      string
+		Arguments string
+	}
+)
+
+func inputSchema(description string) map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"input": map[string]any{
+				"type":        "string",
+				"description": description,
+			},
+		},
+		"required": []string{"input"},
+	}
+}
+
+// ParseToolCalls turns a completion from the functions protocol into an
+// AiResponse. Any text content is still parsed for Thought and Agent lines.
+func ParseToolCalls(completion Completion) AiResponse {
+	response := ParseResponse(completion.Text)
+	if len(completion.ToolCalls) == 0 {
+		return response
+	}
+
+	call := completion.ToolCalls[0]
+	response.Action = call.Name
+	response.ActionInput = toolCallInput(call.Arguments)
+
+	return response
+}
+
+func toolCallInput(arguments string) string {
+	var args map[string]any
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return arguments
+	}
+
+	if input, ok := args["input"].(string); ok && len(args) == 1 {
+		return input
+	}
+
+	return arguments
+}
+
+type (
+	// Observation is the result of running a tool. Text is fed back to the
+	// model as an Observation and Reply, when set, is sent to the customer.
+	Observation struct {
+		Text  string
+		Reply string
+		// Customer is set when the tool identified the customer.
+		Customer *user
+	}
+
+	ToolHandler func(ctx context.Context, input string) (Observation, error)
+
+	Tool struct {
+		Name        string
+		Description string
+		// InputSchema is the JSON schema of the tool's arguments. When nil
+		// the tool takes a single string "input" argument.
+		InputSchema map[string]any
+		Handler     ToolHandler
+		// Hidden tools can be dispatched but are not offered to the model.
+		Hidden bool
+		// Policy controls whether the tool runs automatically, needs
+		// operator approval or is never run. Empty means PolicyAuto.
+		Policy ToolPolicy
+	}
+
+	// ToolRegistry is the single source of truth for the tools offered to
+	// the model and the handlers the Backend dispatches to.
+	ToolRegistry struct {
+		tools map[string]Tool
+		names []string
+	}
+)
+
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{tools: map[string]Tool{}}
+}
+
+func (r *ToolRegistry) Register(tool Tool) {
+	if _, ok := r.tools[tool.Name]; !ok {
+		r.names = append(r.names, tool.Name)
+	}
+	r.tools[tool.Name] = tool
+}
+
+func (r *ToolRegistry) SetPolicy(name string, policy ToolPolicy) error {
+	tool, ok := r.tools[name]
+	if !ok {
+		return fmt.Errorf("unknown tool %q", name)
+	}
+	tool.Policy = policy
+	r.tools[name] = tool
+	return nil
+}
+
+func (r *ToolRegistry) Get(name string) (Tool, bool) {
+	tool, ok := r.tools[name]
+	return tool, ok
+}
+
+// Names returns the visible tool names in registration order. Forbidden
+// tools are never offered to the model.
+func (r *ToolRegistry) Names() []string {
+	names := []string{}
+	for _, name := range r.names {
+		if tool := r.tools[name]; !tool.Hidden && tool.Policy != PolicyForbidden {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Descriptions returns the visible tools as a name -> description map for
+// the ReAct prompt.
+func (r *ToolRegistry) Descriptions() map[string]string {
+	out := map[string]string{}
+	for _, name := range r.Names() {
+		out[name] = r.tools[name].Description
+	}
+	return out
+}
+
+// Definitions returns the visible tools as structured definitions for the
+// functions protocol.
+func (r *ToolRegistry) Definitions() []ToolDefinition {
+	defs := []ToolDefinition{}
+	for _, name := range r.Names() {
+		tool := r.tools[name]
+		schema := tool.InputSchema
+		if schema == nil {
+			schema = inputSchema("The input to " + name)
+		}
+		defs = append(defs, ToolDefinition{
+			Name:        name,
+			Description: tool.Description,
+			Parameters:  schema,
+		})
+	}
+	return defs
+}
@@ -1,40 +1,84 @@
 package clichat
 
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// DraftOutcome is what happened to an AI drafted reply in copilot mode.
+type DraftOutcome string
+
+const (
+	DraftAccepted  DraftOutcome = "accepted"
+	DraftEdited    DraftOutcome = "edited"
+	DraftDiscarded DraftOutcome = "discarded"
+)
+
 type (
 	errMsg error
-	//
-	// AIMsg      struct{ text string }
-	// AgentMsg   struct{ text string }
-	// BackendMsg struct{ text string }
-	//
+
+	// streamChunkMsg carries a fragment of a completion that is still
+	// being generated. streamEndMsg marks the end of that completion.
+	streamChunkMsg string
+	streamEndMsg   struct{}
+
+	// draftsMsg offers the operator candidate Agent replies in copilot mode.
+	draftsMsg struct {
+		Drafts []string
+	}
+
+	// Message is one line of a conversation. ID and Time are set when it
+	// joins the conversation.
 	Message struct {
-		Sender string
-		Text   string
-		Input  string
+		ID     string    `json:"id,omitempty"`
+		Time   time.Time `json:"time"`
+		Sender Role      `json:"sender"`
+		Text   string    `json:"text"`
+		Input  string    `json:"input,omitempty"`
+		// Outcome records what the operator did with a RoleDraft message.
+		Outcome DraftOutcome `json:"outcome,omitempty"`
+		// Customer is the customer a RoleIdentified message identified.
+		Customer *user `json:"customer,omitempty"`
 	}
 
 	Messages []Message
 
 	MessageContext struct {
+		SessionID string
+		// Turn numbers the customer messages of the session, Current
+		// included, so it carries on when a session is resumed.
+		Turn    int
 		Current Message
 		History []Message
+		// Prompt names the prompt template chosen for this conversation.
+		// Empty means the AIClient's default.
+		Prompt string
+	}
+
+	// sessionMsg routes a msg produced for one conversation to it.
+	sessionMsg struct {
+		SessionID string
+		Msg       tea.Msg
 	}
 
-	orderItem struct {
+	OrderItem struct {
 		ProductDesc string `json:"product_desc"`
 		Quantity    int    `json:"quantity"`
 	}
 
-	order struct {
-		OrderNumber string      `json:"order_number"`
-		Items       []orderItem `json:"items"`
-		OrderDate   string      `json:"order_date"`
+	Order struct {
+		OrderNumber   string      `json:"order_number"`
+		Items         []OrderItem `json:"items"`
+		OrderDate     string      `json:"order_date"`
+		CustomerEmail string      `json:"customer_email,omitempty"`
+		CustomerPhone string      `json:"customer_phone,omitempty"`
 	}
 
 	orderResults struct {
 		ResultsFor string  `json:"results_for"`
 		LookupBy   string  `json:"lookup_by"`
-		Orders     []order `json:"orders"`
+		Orders     []Order `json:"orders"`
 	}
 
 	user struct {
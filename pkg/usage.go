@@ -0,0 +1,230 @@
+package clichat
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Price is what a model charges in US dollars per 1000 tokens.
+type Price struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// PriceTable maps model names to prices. Unlisted models match the longest
+// listed prefix and are free if nothing matches.
+type PriceTable map[string]Price
+
+var DefaultPrices = PriceTable{
+	"gpt-3.5-turbo":     {Prompt: 0.0015, Completion: 0.002},
+	"gpt-3.5-turbo-16k": {Prompt: 0.003, Completion: 0.004},
+	"gpt-4":             {Prompt: 0.03, Completion: 0.06},
+	"gpt-4-32k":         {Prompt: 0.06, Completion: 0.12},
+	"gpt-4-turbo":       {Prompt: 0.01, Completion: 0.03},
+	"gpt-4o":            {Prompt: 0.005, Completion: 0.015},
+}
+
+// LoadPriceTable reads a JSON object of model name to Price, e.g.
+//
+//	{"gpt-4": {"prompt": 0.03, "completion": 0.06}}
+//
+// on top of DefaultPrices.
+func LoadPriceTable(path string) (PriceTable, error) {
+	prices := PriceTable{}
+	for model, price := range DefaultPrices {
+		prices[model] = price
+	}
+	if path == "" {
+		return prices, nil
+	}
+
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides := PriceTable{}
+	if err := json.Unmarshal(bts, &overrides); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	for model, price := range overrides {
+		prices[model] = price
+	}
+
+	return prices, nil
+}
+
+func (t PriceTable) Cost(model string, u Usage) float64 {
+	best, price := "", Price{}
+	for prefix, p := range t {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best, price = prefix, p
+		}
+	}
+	return (float64(u.PromptTokens)*price.Prompt + float64(u.CompletionTokens)*price.Completion) / 1000
+}
+
+// UsageRecord is one model call in the usage ledger.
+type UsageRecord struct {
+	Time      time.Time `json:"time"`
+	SessionID string    `json:"session_id,omitempty"`
+	Model     string    `json:"model"`
+	Usage
+	Cost float64 `json:"cost"`
+}
+
+type UsageTotals struct {
+	Calls int
+	// EstimatedCalls counts the calls whose usage was estimated.
+	EstimatedCalls int
+	Usage
+	Cost float64
+}
+
+func (t *UsageTotals) Add(r UsageRecord) {
+	t.Calls++
+	if r.Estimated {
+		t.EstimatedCalls++
+	}
+	t.PromptTokens += r.PromptTokens
+	t.CompletionTokens += r.CompletionTokens
+	t.TotalTokens += r.TotalTokens
+	t.Cost += r.Cost
+}
+
+// usageMsg tells the Model what the latest call cost and the running
+// totals for its session and for today.
+type usageMsg struct {
+	Call    UsageRecord
+	Session UsageTotals
+	Day     UsageTotals
+}
+
+const dayFormat = "2006-01-02"
+
+// Ledger prices every model call, keeps running totals per session and per
+// day and appends each call to a JSONL file. A nil *Ledger records nothing.
+type Ledger struct {
+	mu       sync.Mutex
+	prices   PriceTable
+	enc      *json.Encoder
+	w        io.Writer
+	sessions map[string]UsageTotals
+	days     map[string]UsageTotals
+}
+
+func NewLedger(prices PriceTable, w io.Writer) *Ledger {
+	return &Ledger{
+		prices:   prices,
+		enc:      json.NewEncoder(w),
+		w:        w,
+		sessions: map[string]UsageTotals{},
+		days:     map[string]UsageTotals{},
+	}
+}
+
+// OpenLedger appends to the ledger at path, restoring the totals of the
+// calls already recorded there.
+func OpenLedger(path string, prices PriceTable) (*Ledger, error) {
+	records := []UsageRecord{}
+	if f, err := os.Open(path); err == nil {
+		records, err = ReadUsage(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	l := NewLedger(prices, f)
+	for _, r := range records {
+		l.total(r)
+	}
+	return l, nil
+}
+
+// ReadUsage reads the records of a ledger file.
+func ReadUsage(r io.Reader) ([]UsageRecord, error) {
+	records := []UsageRecord{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var rec UsageRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+// Add prices a call and records it.
+func (l *Ledger) Add(sessionID string, model string, u Usage) UsageRecord {
+	if l == nil {
+		return UsageRecord{}
+	}
+
+	r := UsageRecord{
+		Time:      time.Now(),
+		SessionID: sessionID,
+		Model:     model,
+		Usage:     u,
+		Cost:      l.prices.Cost(model, u),
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total(r)
+	l.enc.Encode(r)
+	return r
+}
+
+func (l *Ledger) total(r UsageRecord) {
+	session := l.sessions[r.SessionID]
+	session.Add(r)
+	l.sessions[r.SessionID] = session
+
+	day := r.Time.Local().Format(dayFormat)
+	totals := l.days[day]
+	totals.Add(r)
+	l.days[day] = totals
+}
+
+func (l *Ledger) Session(id string) UsageTotals {
+	if l == nil {
+		return UsageTotals{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sessions[id]
+}
+
+func (l *Ledger) Day(t time.Time) UsageTotals {
+	if l == nil {
+		return UsageTotals{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.days[t.Local().Format(dayFormat)]
+}
+
+func (l *Ledger) Close() error {
+	if l == nil {
+		return nil
+	}
+	if c, ok := l.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}